@@ -0,0 +1,109 @@
+package Test
+
+import (
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func verifyStreams(t *testing.T, filename string, streams map[string][]byte) {
+	cf, err := mcdf.Open(filename)
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	for name, b := range streams {
+		sm, err := cf.RootStorage().GetStream(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		data, err := sm.GetData()
+		assert.NoError(t, err, name)
+		assert.Equal(t, len(b), len(data), name)
+		assert.True(t, string(b) == string(data), "stream %q differs", name)
+	}
+}
+
+func Test_COMMIT_REOPEN(t *testing.T) {
+	const srcFilename = "files/report.xls"
+	const dstFilename = "files/reportCommitReopen.xls"
+
+	_, err := Copy(srcFilename, dstFilename)
+	assert.NoError(t, err)
+
+	streams := make(map[string][]byte)
+	{
+		cf, err := mcdf.Open(srcFilename)
+		assert.NoError(t, err)
+		for _, name := range []string{"Workbook", "\x05SummaryInformation", "\x05DocumentSummaryInformation"} {
+			sm, err := cf.RootStorage().GetStream(name)
+			assert.NoError(t, err)
+			streams[name], err = sm.GetData()
+			assert.NoError(t, err)
+		}
+		cf.Close()
+	}
+
+	cf, err := mcdf.Open(dstFilename)
+	assert.NoError(t, err)
+	root := cf.RootStorage()
+
+	steps := []func(){
+		func() {
+			// Patch a sector in the middle of the Workbook chain
+			sm, err := root.GetStream("Workbook")
+			assert.NoError(t, err)
+			patch := GetBuffer(100, 0x55)
+			_, err = sm.WriteAt(patch, 20*512+7)
+			assert.NoError(t, err)
+			copy(streams["Workbook"][20*512+7:], patch)
+		},
+		func() {
+			// Mini stream
+			sm, err := root.AddStream("MyMiniStream")
+			assert.NoError(t, err)
+			streams["MyMiniStream"] = GenBuffer(700)
+			assert.NoError(t, sm.SetData(streams["MyMiniStream"]))
+		},
+		func() {
+			// The file grows
+			sm, err := root.AddStream("MyStream")
+			assert.NoError(t, err)
+			streams["MyStream"] = GenBuffer(100000)
+			assert.NoError(t, sm.SetData(streams["MyStream"]))
+		},
+		func() {
+			sm, err := root.GetStream("MyStream")
+			assert.NoError(t, err)
+			b := GenBuffer(5000)
+			assert.NoError(t, sm.Append(b))
+			streams["MyStream"] = append(streams["MyStream"], b...)
+		},
+		func() {
+			sm, err := root.GetStream("MyStream")
+			assert.NoError(t, err)
+			assert.NoError(t, sm.Truncate(3000))
+			streams["MyStream"] = streams["MyStream"][:3000]
+		},
+		func() {
+			sm, err := root.GetStream("Workbook")
+			assert.NoError(t, err)
+			streams["Workbook"] = GenBuffer(9000)
+			assert.NoError(t, sm.SetData(streams["Workbook"]))
+		},
+	}
+	for _, step := range steps {
+		step()
+		err = cf.Commit()
+		assert.NoError(t, err)
+		verifyStreams(t, dstFilename, streams)
+	}
+	cf.Close()
+
+	verifyStreams(t, dstFilename, streams)
+
+	if _, err := os.Stat(dstFilename); err == nil {
+		err = os.Remove(dstFilename)
+		assert.NoError(t, err)
+	}
+}
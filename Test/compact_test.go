@@ -0,0 +1,64 @@
+package Test
+
+import (
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func Test_COMPACT(t *testing.T) {
+	const filename = "files/compact.cfs"
+
+	cf, err := mcdf.Create(filename, 3)
+	assert.NoError(t, err)
+	root := cf.RootStorage()
+
+	streams := make(map[string][]byte)
+	names := []string{"A", "B", "C", "MiniA", "MiniB"}
+	sm := make(map[string]*mcdf.Stream)
+	for _, name := range names {
+		sm[name], err = root.AddStream(name)
+		assert.NoError(t, err)
+	}
+	// Interleaved appends leave the chains fragmented
+	for i := 0; i < 8; i++ {
+		for _, name := range names {
+			size := 5000
+			if name[0] == 'M' {
+				size = 100
+			}
+			b := GetBuffer(size, byte(i+len(name)))
+			assert.NoError(t, sm[name].Append(b))
+			streams[name] = append(streams[name], b...)
+		}
+	}
+	// Free a stream in the middle
+	assert.NoError(t, sm["B"].SetData([]byte{}))
+	streams["B"] = []byte{}
+	assert.NoError(t, cf.Commit())
+
+	stats, err := cf.Compact()
+	assert.NoError(t, err)
+	assert.True(t, stats.FragmentationBefore > 0)
+	assert.Equal(t, float64(0), stats.FragmentationAfter)
+	assert.True(t, stats.Reclaimed() > 0)
+	assert.NoError(t, cf.Commit())
+	cf.Close()
+
+	fi, err := os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, stats.SizeAfter, fi.Size())
+	verifyStreams(t, filename, streams)
+
+	// A compacted file stays compact
+	cf, err = mcdf.Open(filename)
+	assert.NoError(t, err)
+	stats, err = cf.Compact()
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), stats.FragmentationBefore)
+	assert.Equal(t, int64(0), stats.Reclaimed())
+	cf.Close()
+
+	os.Remove(filename)
+}
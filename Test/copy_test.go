@@ -0,0 +1,139 @@
+package Test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_COPY_ENTRY(t *testing.T) {
+	clsid := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	created := time.Date(2010, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	// A version 4 template
+	tmpl, err := mcdf.New(4)
+	assert.NoError(t, err)
+	big := GenBuffer(70000)
+	sm, err := tmpl.CreateStream("Part/Big", mcdf.MkParents)
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(big))
+	small := GenBuffer(1000)
+	sm, err = tmpl.CreateStream("Part/Sub/Small", mcdf.MkParents)
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(small))
+	assert.NoError(t, sm.SetStateBits(3))
+	part, err := tmpl.OpenStorage("Part")
+	assert.NoError(t, err)
+	assert.NoError(t, part.SetCLSID(clsid))
+	assert.NoError(t, part.SetTimes(created, created))
+	assert.Error(t, part.CopyTo(part, "Self"))
+
+	report, err := mcdf.OpenFile("files/report.xls", mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	defer report.Close()
+	workbook, err := report.RootStorage().GetStream("Workbook")
+	assert.NoError(t, err)
+	wb, err := workbook.GetData()
+	assert.NoError(t, err)
+
+	// Into a version 3 document
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	_, err = cf.MkdirAll("Out")
+	assert.NoError(t, err)
+	out, err := cf.OpenStorage("Out")
+	assert.NoError(t, err)
+	assert.NoError(t, part.CopyTo(out, "Part"))
+	for _, e := range entries(t, report.RootStorage()) {
+		if e.Name() == "Workbook" {
+			assert.NoError(t, cf.CopyEntry(e, "Out/Part/Workbook"))
+		}
+	}
+	for _, e := range entries(t, tmpl.RootStorage()) {
+		assert.NoError(t, cf.CopyEntry(e, "Second"))
+		assert.Error(t, cf.CopyEntry(e, "Missing/Second"))
+	}
+	tmpl.Close()
+
+	var buf bytes.Buffer
+	_, err = cf.WriteTo(&buf)
+	assert.NoError(t, err)
+	cf.Close()
+
+	cf, err = mcdf.OpenBytes(buf.Bytes(), mcdf.OpenOptions{ReadOnly: true, ValidateTrees: true})
+	assert.NoError(t, err)
+	defer cf.Close()
+	assert.Equal(t, 3, cf.Version())
+	for path, want := range map[string][]byte{
+		"Out/Part/Big":       big,
+		"Out/Part/Sub/Small": small,
+		"Out/Part/Workbook":  wb,
+		"Second/Big":         big,
+		"Second/Sub/Small":   small,
+	} {
+		sm, err := cf.OpenStream(path)
+		if !assert.NoError(t, err, path) {
+			continue
+		}
+		data, err := sm.GetData()
+		assert.NoError(t, err, path)
+		assert.True(t, bytes.Equal(want, data), path)
+	}
+	st, err := cf.OpenStorage("Out/Part")
+	assert.NoError(t, err)
+	assert.Equal(t, clsid, st.CLSID())
+	assert.True(t, created.Equal(st.Created()))
+	sm, err = cf.OpenStream("Second/Sub/Small")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), sm.StateBits())
+}
+
+func Test_COPY_ENTRY_FAILED(t *testing.T) {
+	src, err := mcdf.New(3)
+	assert.NoError(t, err)
+	_, err = src.CreateStream("S/T/X", mcdf.MkParents)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = src.WriteTo(&buf)
+	assert.NoError(t, err)
+	src.Close()
+	img := buf.Bytes()
+
+	// A sibling id of X pointing to itself
+	x := findEntry(img, 'X')
+	if !assert.True(t, x > 0) {
+		return
+	}
+	dir := (int(binary.LittleEndian.Uint32(img[48:])) + 1) * 512
+	binary.LittleEndian.PutUint32(img[x+68:], uint32((x-dir)/128))
+	src, err = mcdf.OpenBytes(img, mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	defer src.Close()
+	st, err := src.OpenStorage("S")
+	assert.NoError(t, err)
+
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+	_, err = cf.MkdirAll("Dst")
+	assert.NoError(t, err)
+	for _, e := range entries(t, src.RootStorage()) {
+		err = cf.CopyEntry(e, "Dst/S")
+	}
+	var pathErr *mcdf.PathError
+	if assert.True(t, errors.As(err, &pathErr)) {
+		assert.Equal(t, "Dst/S/T", pathErr.Component)
+		assert.True(t, errors.Is(err, mcdf.ErrDirectoryLoop))
+	}
+
+	// The partial copy is removed
+	assert.False(t, cf.Exists("Dst/S"))
+	dst, err := cf.OpenStorage("Dst")
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(st.CopyTo(dst, "S"), mcdf.ErrDirectoryLoop))
+	assert.Equal(t, 0, len(entries(t, dst)))
+}
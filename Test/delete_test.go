@@ -0,0 +1,110 @@
+package Test
+
+import (
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func Test_DELETE_STORAGE(t *testing.T) {
+	const filename = "files/deleteStorage.cfs"
+
+	cf, err := mcdf.Create(filename, 3)
+	assert.NoError(t, err)
+	root := cf.RootStorage()
+
+	st, err := root.AddStorage("MyStorage")
+	assert.NoError(t, err)
+	sm, err := st.AddStream("BigStream")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(GenBuffer(20000)))
+	sub, err := st.AddStorage("SubStorage")
+	assert.NoError(t, err)
+	for _, name := range []string{"Mini1", "Mini2", "Mini3"} {
+		sm, err = sub.AddStream(name)
+		assert.NoError(t, err)
+		assert.NoError(t, sm.SetData(GenBuffer(1000)))
+	}
+	sm, err = root.AddStream("Keep")
+	assert.NoError(t, err)
+	keep := GenBuffer(3000)
+	assert.NoError(t, sm.SetData(keep))
+	assert.NoError(t, cf.Commit())
+	fi, err := os.Stat(filename)
+	assert.NoError(t, err)
+	size := fi.Size()
+
+	assert.Equal(t, mcdf.ErrStorageNotEmpty, root.Delete("MyStorage"))
+	assert.NoError(t, root.Delete("MyStorage", mcdf.DeleteOptions{Recursive: true}))
+	_, err = root.GetStorage("MyStorage")
+	assert.Equal(t, mcdf.NotFoundDirectory, err)
+
+	// The freed sectors and directory entries are reused
+	st, err = root.AddStorage("Other")
+	assert.NoError(t, err)
+	sm, err = st.AddStream("BigStream")
+	assert.NoError(t, err)
+	big := GenBuffer(20000)
+	assert.NoError(t, sm.SetData(big))
+	for _, name := range []string{"Mini1", "Mini2", "Mini3", "Mini4"} {
+		sm, err = st.AddStream(name)
+		assert.NoError(t, err)
+		assert.NoError(t, sm.SetData(GenBuffer(700)))
+	}
+	assert.NoError(t, cf.Commit())
+	cf.Close()
+
+	fi, err = os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, size, fi.Size())
+
+	cf, err = mcdf.Open(filename)
+	assert.NoError(t, err)
+	root = cf.RootStorage()
+	_, err = root.GetStorage("MyStorage")
+	assert.Equal(t, mcdf.NotFoundDirectory, err)
+	st, err = root.GetStorage("Other")
+	assert.NoError(t, err)
+	assert.NoError(t, st.Delete("Mini2"))
+	sm, err = st.GetStream("BigStream")
+	assert.NoError(t, err)
+	data, err := sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, big, data)
+	sm, err = root.GetStream("Keep")
+	assert.NoError(t, err)
+	data, err = sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, keep, data)
+	cf.Close()
+
+	os.Remove(filename)
+}
+
+func Test_DELETE_SHRUNK_STREAM(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+	root := cf.RootStorage()
+
+	// regular and mini streams shrunk before they are deleted
+	for _, size := range [][2]int{{100000, 10000}, {3000, 500}} {
+		sm, err := root.AddStream("Shrunk")
+		assert.NoError(t, err)
+		assert.NoError(t, sm.SetData(GenBuffer(size[0])))
+		assert.NoError(t, sm.SetData(GenBuffer(size[1])))
+		assert.NoError(t, root.Delete("Shrunk"), "%d -> %d", size[0], size[1])
+		_, err = root.GetStream("Shrunk")
+		assert.Equal(t, mcdf.StreamNotFound, err)
+	}
+
+	// The freed sectors are reused
+	sm, err := root.AddStream("Other")
+	assert.NoError(t, err)
+	b := GenBuffer(100000)
+	assert.NoError(t, sm.SetData(b))
+	data, err := sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, b, data)
+}
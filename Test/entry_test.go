@@ -0,0 +1,97 @@
+package Test
+
+import (
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"testing"
+)
+
+// entries lists the storage and expects a well-formed sibling tree.
+func entries(t *testing.T, st *mcdf.Storage) []mcdf.Entry {
+	list, err := st.Entries()
+	assert.NoError(t, err)
+	return list
+}
+
+func Test_STAT(t *testing.T) {
+	cf, err := mcdf.OpenFile("files/MultipleStorage.cfs", mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	st, err := cf.RootStorage().GetStorage("MyStorage")
+	assert.NoError(t, err)
+
+	fi, err := st.Stat("mysecondstream")
+	assert.NoError(t, err)
+	assert.Equal(t, "MySecondStream", fi.Name())
+	assert.Equal(t, int64(336), fi.Size())
+	assert.False(t, fi.IsDir())
+	assert.Equal(t, fs.FileMode(0444), fi.Mode())
+	info, ok := fi.Sys().(*mcdf.EntryInfo)
+	if assert.True(t, ok) {
+		assert.Equal(t, uint32(5), info.ID)
+		assert.Equal(t, mcdf.EntryStream, info.Type)
+		assert.Equal(t, uint64(336), info.Size)
+		assert.Equal(t, uint32(0xFFFFFFFF), info.Child)
+	}
+
+	fi, err = st.Stat("AnotherStorage")
+	assert.NoError(t, err)
+	assert.True(t, fi.IsDir())
+	assert.True(t, fi.Mode().IsDir())
+	assert.Equal(t, int64(0), fi.Size())
+	info = fi.Sys().(*mcdf.EntryInfo)
+	assert.Equal(t, uint32(2), info.ID)
+	assert.Equal(t, uint32(3), info.LeftSibling)
+	assert.Equal(t, uint32(5), info.RightSibling)
+	assert.Equal(t, uint32(4), info.Child)
+
+	_, err = st.Stat("Missing")
+	assert.Equal(t, mcdf.NotFoundDirectory, err)
+}
+
+func Test_ENTRIES(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+	root := cf.RootStorage()
+
+	for _, name := range []string{"Stream1", "b", "A", "Storage", "zz"} {
+		if name == "Storage" {
+			_, err = root.AddStorage(name)
+		} else {
+			_, err = root.AddStream(name)
+		}
+		assert.NoError(t, err)
+	}
+
+	var names []string
+	for _, e := range entries(t, root) {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"A", "b", "zz", "Storage", "Stream1"}, names)
+
+	types := make(map[string]mcdf.EntryType)
+	for e, err := range root.All() {
+		assert.NoError(t, err)
+		types[e.Name()] = e.Type()
+		assert.Equal(t, e.Name(), e.Stat().Name())
+	}
+	assert.Equal(t, mcdf.EntryStorage, types["Storage"])
+	assert.Equal(t, mcdf.EntryStream, types["Stream1"])
+
+	// Stopping early
+	n := 0
+	for range root.All() {
+		n++
+		break
+	}
+	assert.Equal(t, 1, n)
+
+	st, err := entries(t, root)[3].Storage()
+	assert.NoError(t, err)
+	assert.Empty(t, entries(t, st))
+	_, err = entries(t, root)[0].Storage()
+	assert.Error(t, err)
+}
@@ -0,0 +1,151 @@
+//go:build ignore
+
+// gen_v4 writes v4.cfs, the version 4 sample of Test_VERSION_4_SAMPLE.
+// It builds the file from the [MS-CFB] layout with the standard library
+// only, so the sample does not depend on the package it tests:
+//
+//	go run gen_v4.go > v4.cfs
+//
+// The file has 4096-byte sectors: FAT, directory, mini FAT, mini stream
+// and the three sectors of MyStorage/MyStream, in that order. Mini and
+// Small are kept in the mini stream.
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"unicode/utf16"
+)
+
+const (
+	sectorSize = 4096
+	miniSize   = 64
+
+	freeSect   = 0xFFFFFFFF
+	endOfChain = 0xFFFFFFFE
+	fatSect    = 0xFFFFFFFD
+	noStream   = 0xFFFFFFFF
+
+	// 2019-04-17 18:40:00 UTC as a FILETIME
+	modified = 132000000000000000
+)
+
+type entry struct {
+	name               string
+	objectType         uint8
+	left, right, child uint32
+	created, modified  uint64
+	start              uint32
+	size               uint64
+}
+
+func pattern(n, k int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * k)
+	}
+	return b
+}
+
+func put(b []byte, off int, v interface{}) {
+	switch v := v.(type) {
+	case uint16:
+		binary.LittleEndian.PutUint16(b[off:], v)
+	case uint32:
+		binary.LittleEndian.PutUint32(b[off:], v)
+	case uint64:
+		binary.LittleEndian.PutUint64(b[off:], v)
+	}
+}
+
+func main() {
+	mini, small, stream := pattern(300, 3), pattern(100, 5), pattern(10000, 7)
+
+	header := make([]byte, sectorSize)
+	copy(header, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1})
+	put(header, 0x18, uint16(0x3E))       // minor version
+	put(header, 0x1A, uint16(4))          // major version
+	put(header, 0x1C, uint16(0xFFFE))     // byte order
+	put(header, 0x1E, uint16(12))         // sector shift
+	put(header, 0x20, uint16(6))          // mini sector shift
+	put(header, 0x28, uint32(1))          // directory sectors
+	put(header, 0x2C, uint32(1))          // FAT sectors
+	put(header, 0x30, uint32(1))          // first directory sector
+	put(header, 0x38, uint32(4096))       // mini stream cutoff
+	put(header, 0x3C, uint32(2))          // first mini FAT sector
+	put(header, 0x40, uint32(1))          // mini FAT sectors
+	put(header, 0x44, uint32(endOfChain)) // first DIFAT sector
+	for i := 0; i < 109; i++ {
+		put(header, 0x4C+4*i, uint32(freeSect))
+	}
+	put(header, 0x4C, uint32(0)) // the FAT is sector 0
+
+	fat := make([]byte, sectorSize)
+	for i := 0; i < sectorSize/4; i++ {
+		put(fat, 4*i, uint32(freeSect))
+	}
+	for i, next := range []uint32{fatSect, endOfChain, endOfChain, endOfChain, 5, 6, endOfChain} {
+		put(fat, 4*i, next)
+	}
+
+	// Mini occupies mini sectors 0-4, Small 5-6
+	miniFAT := make([]byte, sectorSize)
+	for i := 0; i < sectorSize/4; i++ {
+		put(miniFAT, 4*i, uint32(freeSect))
+	}
+	for i, next := range []uint32{1, 2, 3, 4, endOfChain, 6, endOfChain} {
+		put(miniFAT, 4*i, next)
+	}
+	miniStream := make([]byte, sectorSize)
+	copy(miniStream, mini)
+	copy(miniStream[5*miniSize:], small)
+
+	// Small is the root of the sibling tree of the root storage, with
+	// Mini on its left and MyStorage on its right; every node is black.
+	entries := []entry{
+		{name: "Root Entry", objectType: 5, left: noStream, right: noStream, child: 2,
+			modified: modified, start: 3, size: 7 * miniSize},
+		{name: "Mini", objectType: 2, left: noStream, right: noStream, child: noStream,
+			start: 0, size: uint64(len(mini))},
+		{name: "Small", objectType: 2, left: 1, right: 3, child: noStream,
+			start: 5, size: uint64(len(small))},
+		{name: "MyStorage", objectType: 1, left: noStream, right: noStream, child: 4,
+			created: modified, modified: modified},
+		{name: "MyStream", objectType: 2, left: noStream, right: noStream, child: noStream,
+			start: 4, size: uint64(len(stream))},
+	}
+	dir := make([]byte, sectorSize)
+	for i := 0; i < sectorSize/128; i++ {
+		e := dir[128*i : 128*(i+1)]
+		put(e, 68, uint32(noStream))
+		put(e, 72, uint32(noStream))
+		put(e, 76, uint32(noStream))
+		if i >= len(entries) {
+			continue
+		}
+		de := entries[i]
+		name := utf16.Encode([]rune(de.name))
+		for j, c := range name {
+			put(e, 2*j, c)
+		}
+		put(e, 64, uint16(2*len(name)+2))
+		e[66] = de.objectType
+		e[67] = 1 // black
+		put(e, 68, de.left)
+		put(e, 72, de.right)
+		put(e, 76, de.child)
+		put(e, 100, de.created)
+		put(e, 108, de.modified)
+		put(e, 116, de.start)
+		put(e, 120, de.size)
+	}
+
+	data := make([]byte, 3*sectorSize)
+	copy(data, stream)
+
+	for _, b := range [][]byte{header, fat, dir, miniFAT, miniStream, data} {
+		if _, err := os.Stdout.Write(b); err != nil {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package Test
+
+import (
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_FS(t *testing.T) {
+	cf, err := mcdf.OpenFile("files/MultipleStorage.cfs", mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	fsys := cf.FS()
+	assert.NoError(t, fstest.TestFS(fsys,
+		"MyStorage/MyStream",
+		"MyStorage/MySecondStream",
+		"MyStorage/AnotherStorage/AnotherStream"))
+
+	var paths []string
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		paths = append(paths, path)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		".",
+		"MyStorage",
+		"MyStorage/AnotherStorage",
+		"MyStorage/AnotherStorage/AnotherStream",
+		"MyStorage/MySecondStream",
+		"MyStorage/MyStream",
+	}, paths)
+
+	matches, err := fs.Glob(fsys, "MyStorage/My*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"MyStorage/MySecondStream", "MyStorage/MyStream"}, matches)
+
+	_, err = fs.Stat(fsys, "MyStorage/Missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fs.ReadFile(fsys, "MyStorage")
+	assert.Error(t, err)
+}
+
+func Test_FS_ESCAPE(t *testing.T) {
+	cf, err := mcdf.OpenFile("files/report.xls", mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	fsys := cf.FS()
+	assert.NoError(t, fstest.TestFS(fsys, "Workbook", "%05SummaryInformation"))
+
+	b, err := fs.ReadFile(fsys, "%05SummaryInformation")
+	assert.NoError(t, err)
+	sm, err := cf.RootStorage().GetStream("\x05SummaryInformation")
+	assert.NoError(t, err)
+	data, err := sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, data, b)
+
+	for _, name := range []string{"\x05SummaryInformation", "100%", "a/b", ".", "..", "plain"} {
+		escaped := mcdf.EscapeName(name)
+		assert.True(t, fs.ValidPath(escaped), escaped)
+		raw, err := mcdf.UnescapeName(escaped)
+		assert.NoError(t, err)
+		assert.Equal(t, name, raw)
+	}
+	_, err = mcdf.UnescapeName("bad%4")
+	assert.Error(t, err)
+}
+
+func Test_FS_DOT_NAMES(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+	_, err = cf.CreateStream("./..", mcdf.MkParents)
+	assert.NoError(t, err)
+
+	fsys := cf.FS()
+	entries, err := fs.ReadDir(fsys, ".")
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(entries)) {
+		assert.Equal(t, "%2E", entries[0].Name())
+	}
+	assert.NoError(t, fstest.TestFS(fsys, "%2E/%2E%2E"))
+
+	var paths []string
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		paths = append(paths, path)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".", "%2E", "%2E/%2E%2E"}, paths)
+}
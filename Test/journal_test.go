@@ -0,0 +1,262 @@
+package Test
+
+import (
+	"bytes"
+	"errors"
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var errCrash = errors.New("crash")
+
+// crashWriter fails every write from step limit on. The write it crashes
+// at is torn: the first half of the data reaches the file.
+type crashWriter struct {
+	mcdf.SyncWriter
+	step  *int
+	limit int
+}
+
+func (this *crashWriter) crashed() bool {
+	*this.step++
+	return *this.step > this.limit
+}
+
+func (this *crashWriter) WriteAt(b []byte, off int64) (int, error) {
+	if this.crashed() {
+		if *this.step == this.limit+1 {
+			n, _ := this.SyncWriter.WriteAt(b[:len(b)/2], off)
+			return n, errCrash
+		}
+		return 0, errCrash
+	}
+	return this.SyncWriter.WriteAt(b, off)
+}
+
+func (this *crashWriter) Truncate(size int64) error {
+	if this.crashed() {
+		return errCrash
+	}
+	return this.SyncWriter.Truncate(size)
+}
+
+func (this *crashWriter) Sync() error {
+	if this.crashed() {
+		return errCrash
+	}
+	return this.SyncWriter.Sync()
+}
+
+func Test_JOURNAL_CRASH(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "crash.cfb")
+	old := map[string][]byte{"Small": GenBuffer(300), "Big": GenBuffer(9000)}
+	{
+		cf, err := mcdf.Create(filename, 3)
+		assert.NoError(t, err)
+		for name, b := range old {
+			sm, err := cf.RootStorage().AddStream(name)
+			assert.NoError(t, err)
+			assert.NoError(t, sm.SetData(b))
+		}
+		assert.NoError(t, cf.Commit())
+		cf.Close()
+	}
+	image, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+
+	updated := map[string][]byte{"Small": GenBuffer(300), "Big": GenBuffer(20000), "New": GenBuffer(5000)}
+	recoveredNew := false
+	for limit := 0; ; limit++ {
+		assert.NoError(t, os.WriteFile(filename, image, 0644))
+		step := 0
+		cf, err := mcdf.OpenFile(filename, mcdf.OpenOptions{
+			Durable: true,
+			WrapWriter: func(name string, w mcdf.SyncWriter) mcdf.SyncWriter {
+				return &crashWriter{SyncWriter: w, step: &step, limit: limit}
+			},
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		root := cf.RootStorage()
+		for name, b := range updated {
+			sm, err := root.GetStream(name)
+			if err != nil {
+				sm, err = root.AddStream(name)
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, sm.SetData(b))
+		}
+		err = cf.Commit()
+		cf.Close()
+		if err == nil {
+			_, err = os.Stat(filename + mcdf.JournalSuffix)
+			assert.True(t, os.IsNotExist(err))
+			verifyStreams(t, filename, updated)
+			break
+		}
+		assert.Equal(t, errCrash, err, "step %d", limit)
+
+		// The next open recovers the file to either the old or the new state
+		cf, err = mcdf.OpenFile(filename, mcdf.OpenOptions{ValidateTrees: true})
+		if !assert.NoError(t, err, "step %d", limit) {
+			continue
+		}
+		_, err = os.Stat(filename + mcdf.JournalSuffix)
+		assert.True(t, os.IsNotExist(err), "step %d", limit)
+		_, err = cf.RootStorage().GetStream("New")
+		cf.Close()
+		if err == nil {
+			recoveredNew = true
+			verifyStreams(t, filename, updated)
+		} else {
+			assert.False(t, recoveredNew, "step %d went back to the old state", limit)
+			verifyStreams(t, filename, old)
+		}
+	}
+	assert.True(t, recoveredNew)
+}
+
+func Test_JOURNAL_TORN(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "torn.cfb")
+	cf, err := mcdf.Create(filename, 3)
+	assert.NoError(t, err)
+	cf.Close()
+	image, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	journal := []byte("MCDFJRNL\x00\x02")
+	assert.NoError(t, os.WriteFile(filename+mcdf.JournalSuffix, journal, 0644))
+
+	// A read-only open leaves a journal that was not completely written
+	cf, err = mcdf.OpenFile(filename, mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	cf.Close()
+	b, err := os.ReadFile(filename + mcdf.JournalSuffix)
+	assert.NoError(t, err)
+	assert.Equal(t, journal, b)
+
+	// and a writable open discards it
+	cf, err = mcdf.Open(filename)
+	assert.NoError(t, err)
+	cf.Close()
+	_, err = os.Stat(filename + mcdf.JournalSuffix)
+	assert.True(t, os.IsNotExist(err))
+	b, err = os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, image, b)
+}
+
+func Test_JOURNAL_FOREIGN(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "foreign.cfb")
+	cf, err := mcdf.Create(filename, 3)
+	assert.NoError(t, err)
+	cf.Close()
+	foreign := []byte("not a journal, but named like one")
+	assert.NoError(t, os.WriteFile(filename+mcdf.JournalSuffix, foreign, 0644))
+
+	// Neither open treats the file as a journal or removes it
+	for _, opts := range []mcdf.OpenOptions{{ReadOnly: true}, {}} {
+		_, err = mcdf.OpenFile(filename, opts)
+		assert.ErrorIs(t, err, mcdf.ErrNotJournal)
+		b, err := os.ReadFile(filename + mcdf.JournalSuffix)
+		assert.NoError(t, err)
+		assert.Equal(t, foreign, b)
+	}
+
+	// A torn journal may be shorter than the magic
+	assert.NoError(t, os.WriteFile(filename+mcdf.JournalSuffix, []byte("MCDF"), 0644))
+	cf, err = mcdf.Open(filename)
+	assert.NoError(t, err)
+	cf.Close()
+	_, err = os.Stat(filename + mcdf.JournalSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_JOURNAL_READ_ONLY(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "readonly.cfb")
+	cf, err := mcdf.Create(filename, 3)
+	assert.NoError(t, err)
+	sm, err := cf.RootStorage().AddStream("Small")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(GenBuffer(300)))
+	assert.NoError(t, cf.Commit())
+	cf.Close()
+
+	// Crash at the first write to the file, after the journal is synced
+	step := 0
+	cf, err = mcdf.OpenFile(filename, mcdf.OpenOptions{
+		Durable: true,
+		WrapWriter: func(name string, w mcdf.SyncWriter) mcdf.SyncWriter {
+			if name != filename {
+				return w
+			}
+			return &crashWriter{SyncWriter: w, step: &step, limit: 0}
+		},
+	})
+	assert.NoError(t, err)
+	updated := map[string][]byte{"Small": GenBuffer(300), "Big": GenBuffer(20000)}
+	for name, b := range updated {
+		sm, err = cf.CreateStream(name)
+		if err != nil {
+			sm, err = cf.OpenStream(name)
+		}
+		assert.NoError(t, err)
+		assert.NoError(t, sm.SetData(b))
+	}
+	assert.Equal(t, errCrash, cf.Commit())
+	cf.Close()
+	image, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	journal, err := os.ReadFile(filename + mcdf.JournalSuffix)
+	assert.NoError(t, err)
+
+	// A read-only open sees the recovered file but writes nothing
+	cf, err = mcdf.OpenFile(filename, mcdf.OpenOptions{ReadOnly: true, ValidateTrees: true})
+	if assert.NoError(t, err) {
+		for name, b := range updated {
+			sm, err := cf.OpenStream(name)
+			if assert.NoError(t, err, name) {
+				data, err := sm.GetData()
+				assert.NoError(t, err, name)
+				assert.Equal(t, b, data, name)
+			}
+		}
+		cf.Close()
+	}
+	b, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, image, b)
+	b, err = os.ReadFile(filename + mcdf.JournalSuffix)
+	assert.NoError(t, err)
+	assert.Equal(t, journal, b)
+
+	// A writable open recovers the file
+	cf, err = mcdf.Open(filename)
+	assert.NoError(t, err)
+	cf.Close()
+	_, err = os.Stat(filename + mcdf.JournalSuffix)
+	assert.True(t, os.IsNotExist(err))
+	verifyStreams(t, filename, updated)
+}
+
+func Test_JOURNAL_READER(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = cf.WriteTo(&buf)
+	assert.NoError(t, err)
+	cf.Close()
+
+	// A reader has no file for a journal to go next to
+	_, err = mcdf.OpenBytes(buf.Bytes(), mcdf.OpenOptions{Durable: true})
+	assert.Error(t, err)
+	wrap := func(name string, w mcdf.SyncWriter) mcdf.SyncWriter { return w }
+	_, err = mcdf.OpenBytes(buf.Bytes(), mcdf.OpenOptions{WrapWriter: wrap})
+	assert.Error(t, err)
+	cf, err = mcdf.OpenBytes(buf.Bytes(), mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	cf.Close()
+}
@@ -0,0 +1,102 @@
+package Test
+
+import (
+	"bytes"
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_METADATA_ROUND_TRIP(t *testing.T) {
+	// CLSID of a Word document
+	clsid := [16]byte{0x06, 0x09, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}
+
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	root := cf.RootStorage()
+	assert.Equal(t, [16]byte{}, root.CLSID())
+	assert.NoError(t, root.SetCLSID(clsid))
+
+	st, err := root.AddStorage("MyStorage")
+	assert.NoError(t, err)
+	assert.Equal(t, [16]byte{}, st.CLSID())
+	assert.NoError(t, st.SetStateBits(0x12345678))
+	sm, err := st.AddStream("MyStream")
+	assert.NoError(t, err)
+	assert.Equal(t, [16]byte{}, sm.CLSID())
+	assert.NoError(t, sm.SetStateBits(7))
+
+	var buf bytes.Buffer
+	_, err = cf.WriteTo(&buf)
+	assert.NoError(t, err)
+	cf.Close()
+
+	cf, err = mcdf.OpenBytes(buf.Bytes(), mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	defer cf.Close()
+	root = cf.RootStorage()
+	assert.Equal(t, clsid, root.CLSID())
+	st, err = root.GetStorage("MyStorage")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0x12345678), st.StateBits())
+	sm, err = st.GetStream("MyStream")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(7), sm.StateBits())
+
+	assert.Equal(t, mcdf.ErrReadOnly, root.SetCLSID([16]byte{}))
+	assert.Equal(t, mcdf.ErrReadOnly, sm.SetStateBits(0))
+}
+
+func Test_METADATA_TIMES(t *testing.T) {
+	created := time.Date(2001, 2, 3, 4, 5, 6, 123456700, time.UTC)
+	modified := time.Date(2024, 12, 31, 23, 59, 59, 999999900, time.UTC)
+
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	root := cf.RootStorage()
+	assert.True(t, root.Created().IsZero())
+	assert.False(t, root.Modified().IsZero())
+	assert.Equal(t, mcdf.ErrRootCreated, root.SetTimes(created, modified))
+	assert.NoError(t, root.SetTimes(time.Time{}, modified))
+
+	st, err := root.AddStorage("MyStorage")
+	assert.NoError(t, err)
+	assert.False(t, st.Created().IsZero())
+	assert.NoError(t, st.SetTimes(created, modified))
+
+	sm, err := st.AddStream("MyStream")
+	assert.NoError(t, err)
+	assert.True(t, sm.Created().IsZero())
+	assert.True(t, sm.Modified().IsZero())
+	assert.Equal(t, mcdf.ErrStreamTimes, sm.SetTimes(created, modified))
+	assert.NoError(t, sm.SetTimes(time.Time{}, time.Time{}))
+
+	var buf bytes.Buffer
+	_, err = cf.WriteTo(&buf)
+	assert.NoError(t, err)
+	cf.Close()
+
+	cf, err = mcdf.OpenBytes(buf.Bytes())
+	assert.NoError(t, err)
+	defer cf.Close()
+	root = cf.RootStorage()
+	assert.True(t, root.Created().IsZero())
+	assert.True(t, modified.Equal(root.Modified()), "%v", root.Modified())
+	st, err = root.GetStorage("MyStorage")
+	assert.NoError(t, err)
+	assert.True(t, created.Equal(st.Created()), "%v", st.Created())
+	assert.True(t, modified.Equal(st.Modified()), "%v", st.Modified())
+	sm, err = st.GetStream("MyStream")
+	assert.NoError(t, err)
+	assert.True(t, sm.Created().IsZero())
+	assert.True(t, sm.Modified().IsZero())
+}
+
+func Test_FILETIME(t *testing.T) {
+	// 1601-01-01 is FILETIME 0, the Unix epoch 116444736000000000
+	assert.True(t, mcdf.ToTime(0).IsZero())
+	assert.True(t, time.Unix(0, 0).Equal(mcdf.ToTime(116444736000000000)))
+	assert.True(t, time.Date(1601, 1, 1, 0, 0, 0, 100, time.UTC).Equal(mcdf.ToTime(1)))
+}
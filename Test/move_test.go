@@ -0,0 +1,78 @@
+package Test
+
+import (
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func Test_RENAME_AND_MOVE(t *testing.T) {
+	const filename = "files/renameMove.cfs"
+
+	cf, err := mcdf.Create(filename, 3)
+	assert.NoError(t, err)
+	big := GenBuffer(30000)
+	small := GenBuffer(300)
+	sm, err := cf.CreateStream("Src/Big", mcdf.MkParents)
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(big))
+	sm, err = cf.CreateStream("Src/Inner/Small", mcdf.MkParents)
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(small))
+	for _, name := range []string{"Dst/One", "Dst/Two", "Dst/Three"} {
+		_, err = cf.CreateStream(name, mcdf.MkParents)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, cf.Commit())
+	fi, err := os.Stat(filename)
+	assert.NoError(t, err)
+	size := fi.Size()
+
+	src, err := cf.OpenStorage("Src")
+	assert.NoError(t, err)
+	dst, err := cf.OpenStorage("Dst")
+	assert.NoError(t, err)
+
+	assert.NoError(t, src.Rename("Big", "Large"))
+	assert.Equal(t, mcdf.NotFoundDirectory, src.Rename("Big", "Other"))
+	assert.Equal(t, mcdf.ErrExist, dst.Rename("One", "two"))
+	assert.NoError(t, dst.Rename("One", "ONE"))
+
+	assert.NoError(t, src.Move("Large", dst, "Big"))
+	assert.NoError(t, src.Move("Inner", dst, "Inner"))
+	assert.Error(t, cf.RootStorage().Move("Dst", dst, "Loop"))
+	inner, err := cf.OpenStorage("Dst/Inner")
+	assert.NoError(t, err)
+	assert.Error(t, cf.RootStorage().Move("Dst", inner, "Loop"))
+	assert.Empty(t, entries(t, src))
+	assert.NoError(t, cf.Commit())
+	cf.Close()
+
+	fi, err = os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, size, fi.Size())
+
+	cf, err = mcdf.OpenFile(filename, mcdf.OpenOptions{ValidateTrees: true})
+	assert.NoError(t, err)
+	var paths []string
+	assert.NoError(t, cf.Walk(func(path string, e mcdf.Entry, err error) error {
+		paths = append(paths, path)
+		return err
+	}))
+	assert.ElementsMatch(t, []string{".", "Dst", "Src", "Dst/Big", "Dst/ONE", "Dst/Two", "Dst/Three",
+		"Dst/Inner", "Dst/Inner/Small"}, paths)
+	sm, err = cf.OpenStream("Dst/Big")
+	assert.NoError(t, err)
+	data, err := sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, big, data)
+	sm, err = cf.OpenStream("Dst/Inner/Small")
+	assert.NoError(t, err)
+	data, err = sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, small, data)
+	cf.Close()
+
+	os.Remove(filename)
+}
@@ -1,11 +1,13 @@
 package Test
 
 import (
+	"bytes"
 	"fmt"
 	mcdf "github.com/AlkBur/openmcdf"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -532,6 +534,8 @@ func Test_DELETE_STREAM_1(t *testing.T) {
 	cfs, err := cf.RootStorage().GetStorage("MyStorage")
 	assert.NoError(t, err)
 	err = cfs.Delete("MySecondStream")
+	assert.NoError(t, err)
+	err = cfs.Delete("MySecondStream")
 	assert.Error(t, err)
 	assert.Equal(t, err, mcdf.NotFoundDirectory)
 
@@ -558,7 +562,7 @@ func Test_DELETE_STREAM_2(t *testing.T) {
 	cfs, err = cfs.GetStorage("AnotherStorage")
 	assert.NoError(t, err)
 
-	cfs.Delete("AnotherStream")
+	err = cfs.Delete("AnotherStream")
 	assert.NoError(t, err)
 
 	err = cf.Save(dstFilename)
@@ -689,3 +693,205 @@ func Test_APPEND_DATA_TO_STREAM(t *testing.T) {
 		assert.NoError(t, err)
 	}
 }
+
+func Test_OPEN_BYTES(t *testing.T) {
+	const filename = "files/report.xls"
+
+	cf, err := mcdf.Open(filename)
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	b, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	cfb, err := mcdf.OpenBytes(b)
+	assert.NoError(t, err)
+	defer cfb.Close()
+
+	assert.Equal(t, cf.Version(), cfb.Version())
+
+	sm, err := cf.RootStorage().GetStream("Workbook")
+	assert.NoError(t, err)
+	smb, err := cfb.RootStorage().GetStream("Workbook")
+	assert.NoError(t, err)
+	assert.Equal(t, sm.Size(), smb.Size())
+
+	data, err := sm.GetData()
+	assert.NoError(t, err)
+	datab, err := smb.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, data, datab)
+
+	_, err = mcdf.OpenBytes(b[:mcdf.HeaderSize-1])
+	assert.Equal(t, mcdf.WrongFormat, err)
+}
+
+func Test_READ_ONLY(t *testing.T) {
+	const srcFilename = "files/report.xls"
+	const dstFilename = "files/reportReadOnly.xls"
+
+	_, err := Copy(srcFilename, dstFilename)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chmod(dstFilename, 0444))
+
+	cf, err := mcdf.OpenFile(dstFilename, mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	assert.True(t, cf.ReadOnly())
+
+	_, err = cf.RootStorage().AddStream("MyNewStream")
+	assert.Equal(t, mcdf.ErrReadOnly, err)
+	_, err = cf.RootStorage().AddStorage("MyNewStorage")
+	assert.Equal(t, mcdf.ErrReadOnly, err)
+	err = cf.RootStorage().Delete("Workbook")
+	assert.Equal(t, mcdf.ErrReadOnly, err)
+
+	sm, err := cf.RootStorage().GetStream("Workbook")
+	assert.NoError(t, err)
+	err = sm.SetData(GetBuffer(10, 1))
+	assert.Equal(t, mcdf.ErrReadOnly, err)
+
+	err = cf.Commit()
+	assert.Equal(t, mcdf.ErrReadOnly, err)
+	cf.Close()
+
+	src, err := ioutil.ReadFile(srcFilename)
+	assert.NoError(t, err)
+	dst, err := ioutil.ReadFile(dstFilename)
+	assert.NoError(t, err)
+	assert.Equal(t, src, dst)
+
+	if _, err := os.Stat(dstFilename); err == nil {
+		err = os.Remove(dstFilename)
+		assert.NoError(t, err)
+	}
+}
+
+func Test_WRITE_TO(t *testing.T) {
+	const filename = "files/WRITE_TO.cfs"
+
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	st, err := cf.RootStorage().AddStorage("MyStorage")
+	assert.NoError(t, err)
+	sm, err := st.AddStream("MyStream")
+	assert.NoError(t, err)
+	err = sm.SetData(GenBuffer(10000))
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	n, err := cf.WriteTo(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+
+	err = cf.Save(filename)
+	assert.NoError(t, err)
+	cf.Close()
+
+	b, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), b)
+
+	cf, err = mcdf.OpenBytes(buf.Bytes())
+	assert.NoError(t, err)
+	st, err = cf.RootStorage().GetStorage("MyStorage")
+	assert.NoError(t, err)
+	sm, err = st.GetStream("MyStream")
+	assert.NoError(t, err)
+	assert.NotNil(t, sm)
+	cf.Close()
+
+	if _, err := os.Stat(filename); err == nil {
+		err = os.Remove(filename)
+		assert.NoError(t, err)
+	}
+}
+
+func Test_CREATE_AND_COMMIT(t *testing.T) {
+	const filename = "files/CREATE_AND_COMMIT.cfs"
+
+	b1 := GenBuffer(300)
+	b2 := GenBuffer(20000)
+
+	cf, err := mcdf.Create(filename, 3)
+	assert.NoError(t, err)
+	sm, err := cf.RootStorage().AddStream("MyMiniStream")
+	assert.NoError(t, err)
+	err = sm.SetData(b1)
+	assert.NoError(t, err)
+	err = cf.Commit()
+	assert.NoError(t, err)
+
+	st, err := cf.RootStorage().AddStorage("MyStorage")
+	assert.NoError(t, err)
+	sm, err = st.AddStream("MyStream")
+	assert.NoError(t, err)
+	err = sm.SetData(b2)
+	assert.NoError(t, err)
+	err = cf.Commit()
+	assert.NoError(t, err)
+
+	data, err := sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, b2, data)
+	cf.Close()
+
+	cf, err = mcdf.Open(filename)
+	assert.NoError(t, err)
+	sm, err = cf.RootStorage().GetStream("MyMiniStream")
+	assert.NoError(t, err)
+	data, err = sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, b1, data)
+
+	st, err = cf.RootStorage().GetStorage("MyStorage")
+	assert.NoError(t, err)
+	sm, err = st.GetStream("MyStream")
+	assert.NoError(t, err)
+	data, err = sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, b2, data)
+	cf.Close()
+
+	if _, err := os.Stat(filename); err == nil {
+		err = os.Remove(filename)
+		assert.NoError(t, err)
+	}
+}
+
+func Test_CREATE_COMMIT_MANY(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "CREATE_COMMIT_MANY.cfs")
+
+	cf, err := mcdf.Create(filename, 3)
+	assert.NoError(t, err)
+	streams := make(map[string][]byte)
+	for i, size := range []int{100, 5000, 3000, 70000, 10} {
+		name := fmt.Sprintf("Stream%d", i)
+		sm, err := cf.RootStorage().AddStream(name)
+		assert.NoError(t, err)
+		streams[name] = GenBuffer(size)
+		assert.NoError(t, sm.SetData(streams[name]))
+		if i > 0 {
+			//Grow a stream committed before
+			prev := fmt.Sprintf("Stream%d", i-1)
+			sm, err = cf.RootStorage().GetStream(prev)
+			assert.NoError(t, err)
+			assert.NoError(t, sm.Append(GetBuffer(size, byte(i))))
+			streams[prev] = append(streams[prev], GetBuffer(size, byte(i))...)
+		}
+		assert.NoError(t, cf.Commit())
+		verifyStreams(t, filename, streams)
+	}
+	cf.Close()
+	verifyStreams(t, filename, streams)
+}
+
+func Test_OPEN_WRONG_FORMAT(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "WRONG_FORMAT.cfs")
+	assert.NoError(t, os.WriteFile(filename, make([]byte, 1024), 0644))
+
+	for _, opts := range []mcdf.OpenOptions{{}, {ReadOnly: true}} {
+		cf, err := mcdf.OpenFile(filename, opts)
+		assert.Error(t, err)
+		assert.True(t, cf == nil)
+	}
+	assert.NoError(t, os.Remove(filename))
+}
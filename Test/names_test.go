@@ -0,0 +1,103 @@
+package Test
+
+import (
+	"bytes"
+	"errors"
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_NAME_CASE_INSENSITIVE(t *testing.T) {
+	cf, err := mcdf.OpenFile("files/report.xls", mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	sm, err := cf.RootStorage().GetStream("workbook")
+	assert.NoError(t, err)
+	assert.NotNil(t, sm)
+	sm, err = cf.RootStorage().GetStream("WORKBOOK")
+	assert.NoError(t, err)
+	assert.NotNil(t, sm)
+}
+
+func Test_NAME_ORDER(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	root := cf.RootStorage()
+
+	// Shorter names sort first, then case-insensitively
+	for _, name := range []string{"zz", "B", "a", "Abc", "abd", "c", "Ä", "ä1", "MyStream", "x"} {
+		_, err = root.AddStream(name)
+		assert.NoError(t, err, name)
+	}
+	_, err = root.AddStream("MYSTREAM")
+	assert.Error(t, err)
+	_, err = root.AddStorage("mystream")
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	_, err = cf.WriteTo(&buf)
+	assert.NoError(t, err)
+	cf.Close()
+
+	cf, err = mcdf.OpenBytes(buf.Bytes(), mcdf.OpenOptions{ValidateTrees: true})
+	assert.NoError(t, err)
+	_, err = cf.RootStorage().GetStream("ABD")
+	assert.NoError(t, err)
+	cf.Close()
+}
+
+// findEntry returns the offset of the directory entry with a one letter name.
+func findEntry(b []byte, name byte) int {
+	for off := 512; off+128 <= len(b); off += 128 {
+		if b[off] == name && b[off+1] == 0 && b[off+2] == 0 && b[off+64] == 4 {
+			return off
+		}
+	}
+	return -1
+}
+
+func Test_REBALANCE_TREES(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	for _, name := range []string{"A", "B", "C"} {
+		_, err = cf.RootStorage().AddStream(name)
+		assert.NoError(t, err)
+	}
+	var buf bytes.Buffer
+	_, err = cf.WriteTo(&buf)
+	assert.NoError(t, err)
+	cf.Close()
+
+	// Swap the siblings of the tree root, so the tree is out of order
+	img := buf.Bytes()
+	off := findEntry(img, 'B')
+	if !assert.True(t, off > 0) {
+		return
+	}
+	left := append([]byte{}, img[off+68:off+72]...)
+	copy(img[off+68:off+72], img[off+72:off+76])
+	copy(img[off+72:off+76], left)
+
+	_, err = mcdf.OpenBytes(img, mcdf.OpenOptions{ValidateTrees: true})
+	assert.True(t, errors.Is(err, mcdf.ErrInvalidTree), "%v", err)
+
+	_, err = mcdf.OpenBytes(img, mcdf.OpenOptions{ReadOnly: true, RebalanceTrees: true})
+	assert.Equal(t, mcdf.ErrReadOnly, err)
+
+	cf, err = mcdf.OpenBytes(img, mcdf.OpenOptions{RebalanceTrees: true})
+	assert.NoError(t, err)
+	buf.Reset()
+	_, err = cf.WriteTo(&buf)
+	assert.NoError(t, err)
+	cf.Close()
+
+	cf, err = mcdf.OpenBytes(buf.Bytes(), mcdf.OpenOptions{ValidateTrees: true})
+	assert.NoError(t, err)
+	for _, name := range []string{"a", "b", "c"} {
+		_, err = cf.RootStorage().GetStream(name)
+		assert.NoError(t, err, name)
+	}
+	cf.Close()
+}
@@ -0,0 +1,110 @@
+package Test
+
+import (
+	"errors"
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func pathError(t *testing.T, err error, component string, target error) {
+	var pe *mcdf.PathError
+	if assert.True(t, errors.As(err, &pe), "%v", err) {
+		assert.Equal(t, component, pe.Component)
+		assert.True(t, errors.Is(err, target), "%v", err)
+	}
+}
+
+func Test_PATH_OPEN(t *testing.T) {
+	cf, err := mcdf.OpenFile("files/MultipleStorage.cfs", mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	sm, err := cf.OpenStream("MyStorage/AnotherStorage/AnotherStream")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(512), sm.Size())
+	_, err = cf.OpenStream("/mystorage/anotherstorage/anotherstream")
+	assert.NoError(t, err)
+
+	st, err := cf.OpenStorage("MyStorage/AnotherStorage")
+	assert.NoError(t, err)
+	assert.NotNil(t, st)
+
+	assert.True(t, cf.Exists("MyStorage/MySecondStream"))
+	assert.True(t, cf.Exists(""))
+	assert.False(t, cf.Exists("MyStorage/Missing"))
+
+	_, err = cf.OpenStream("MyStorage/Missing/AnotherStream")
+	pathError(t, err, "MyStorage/Missing", mcdf.NotFoundDirectory)
+	_, err = cf.OpenStream("MyStorage/MyStream/AnotherStream")
+	pathError(t, err, "MyStorage/MyStream", mcdf.ErrNotStorage)
+	_, err = cf.OpenStream("MyStorage/AnotherStorage")
+	pathError(t, err, "MyStorage/AnotherStorage", mcdf.ErrNotStream)
+	_, err = cf.OpenStorage("MyStorage/MyStream")
+	pathError(t, err, "MyStorage/MyStream", mcdf.ErrNotStorage)
+}
+
+func Test_PATH_CREATE(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	_, err = cf.CreateStream("a/b/c")
+	pathError(t, err, "a", mcdf.NotFoundDirectory)
+
+	sm, err := cf.CreateStream("a/b/c", mcdf.MkParents)
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(GenBuffer(100)))
+	assert.True(t, cf.Exists("a/b/c"))
+
+	_, err = cf.CreateStream("a/b/c")
+	pathError(t, err, "a/b/c", mcdf.ErrExist)
+	_, err = cf.CreateStream("a/b/c/d", mcdf.MkParents)
+	pathError(t, err, "a/b/c", mcdf.ErrNotStorage)
+
+	st, err := cf.MkdirAll("a/b/x/y")
+	assert.NoError(t, err)
+	_, err = st.CreateStream("z")
+	assert.NoError(t, err)
+	assert.True(t, cf.Exists("a/b/x/y/z"))
+	_, err = cf.MkdirAll("a/b")
+	assert.NoError(t, err)
+
+	assert.NoError(t, cf.RemoveAll("a/b/x"))
+	assert.False(t, cf.Exists("a/b/x"))
+	assert.True(t, cf.Exists("a/b/c"))
+	assert.NoError(t, cf.RemoveAll("a/b/x"))
+	assert.NoError(t, cf.RemoveAll("missing/path"))
+	pathError(t, cf.RemoveAll("a/b/c/d"), "a/b/c", mcdf.ErrNotStorage)
+	assert.NoError(t, cf.RemoveAll("a"))
+	assert.Empty(t, entries(t, cf.RootStorage()))
+}
+
+func Test_PATH_HANDLES(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	st, err := cf.MkdirAll("D")
+	assert.NoError(t, err)
+	_, err = st.AddStream("a")
+	assert.NoError(t, err)
+	_, err = cf.CreateStream("D/b")
+	assert.NoError(t, err)
+	_, err = st.AddStream("c")
+	assert.NoError(t, err)
+	_, err = cf.CreateStream("e")
+	assert.NoError(t, err)
+	assert.NoError(t, cf.RootStorage().Move("e", st, "e"))
+	_, err = st.AddStream("f")
+	assert.NoError(t, err)
+
+	cf2, err := mcdf.OpenBytes(image(t, cf), mcdf.OpenOptions{ValidateTrees: true})
+	if assert.NoError(t, err) {
+		defer cf2.Close()
+		for _, path := range []string{"D/a", "D/b", "D/c", "D/e", "D/f"} {
+			assert.True(t, cf2.Exists(path), path)
+		}
+		assert.False(t, cf2.Exists("e"))
+	}
+}
@@ -0,0 +1,106 @@
+package Test
+
+import (
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_SAVE_PERMISSIONS(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "perm.cfb")
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	assert.NoError(t, cf.Save(filename))
+	fi, err := os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), fi.Mode().Perm())
+
+	// The permission of the replaced file is kept
+	assert.NoError(t, os.Chmod(filename, 0600))
+	assert.NoError(t, cf.Save(filename, mcdf.SaveOptions{Durability: mcdf.NoSync}))
+	fi, err = os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	assert.NoError(t, cf.Save(filename, mcdf.SaveOptions{Mode: 0640, Durability: mcdf.SyncFile}))
+	fi, err = os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+}
+
+func Test_SAVE_FAILED(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "target")
+	assert.NoError(t, os.Mkdir(filename, 0755))
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	// The rename over a directory fails and the temporary file is removed
+	assert.Error(t, cf.Save(filename))
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	fi, err := os.Stat(filename)
+	assert.NoError(t, err)
+	assert.True(t, fi.IsDir())
+}
+
+func Test_SAVE_OVER_SOURCE(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "source.cfb")
+	streams := map[string][]byte{"Small": GenBuffer(300), "Big": GenBuffer(9000)}
+	cf, err := mcdf.Create(filename, 3)
+	assert.NoError(t, err)
+	sm, err := cf.RootStorage().AddStream("Small")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(streams["Small"]))
+	assert.NoError(t, cf.Commit())
+
+	sm, err = cf.RootStorage().AddStream("Big")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(streams["Big"]))
+	tx, err := cf.Begin()
+	assert.NoError(t, err)
+	assert.Equal(t, mcdf.ErrTxActive, cf.Save(filename))
+	assert.NoError(t, tx.Commit())
+	assert.NoError(t, cf.Save(filename))
+	verifyStreams(t, filename, streams)
+
+	// The compound file is bound to the new file
+	streams["New"] = GenBuffer(5000)
+	sm, err = cf.RootStorage().AddStream("New")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(streams["New"]))
+	assert.NoError(t, cf.Commit())
+	cf.Close()
+	verifyStreams(t, filename, streams)
+}
+
+func Test_SAVE_OVER_READ_ONLY_SOURCE(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "readonly.cfb")
+	cf, err := mcdf.Create(filename, 3)
+	assert.NoError(t, err)
+	cf.Close()
+	image, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+
+	cf, err = mcdf.OpenFile(filename, mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	defer cf.Close()
+	assert.Equal(t, mcdf.ErrReadOnly, cf.Save(filename))
+	b, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, image, b)
+
+	// Saving a copy elsewhere is still allowed
+	assert.NoError(t, cf.Save(filename+".copy"))
+}
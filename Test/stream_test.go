@@ -0,0 +1,259 @@
+package Test
+
+import (
+	"bytes"
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+func Test_STREAM_READER(t *testing.T) {
+	for _, size := range []int{1023, 10000} {
+		b := GenBuffer(size)
+
+		cf, err := mcdf.New(3)
+		assert.NoError(t, err)
+		sm, err := cf.RootStorage().AddStream("MyStream")
+		assert.NoError(t, err)
+		err = sm.SetData(b)
+		assert.NoError(t, err)
+
+		data, err := ioutil.ReadAll(sm)
+		assert.NoError(t, err)
+		assert.Equal(t, b, data)
+
+		pos, err := sm.Seek(-100, io.SeekEnd)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size-100), pos)
+		data, err = ioutil.ReadAll(sm)
+		assert.NoError(t, err)
+		assert.Equal(t, b[size-100:], data)
+
+		part := make([]byte, 700)
+		n, err := sm.ReadAt(part, 300)
+		assert.NoError(t, err)
+		assert.Equal(t, 700, n)
+		assert.Equal(t, b[300:1000], part)
+
+		n, err = sm.ReadAt(part, int64(size-10))
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, 10, n)
+		assert.Equal(t, b[size-10:], part[:n])
+
+		_, err = sm.Seek(0, io.SeekStart)
+		assert.NoError(t, err)
+		buf := bytes.NewBuffer(nil)
+		written, err := sm.WriteTo(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size), written)
+		assert.Equal(t, b, buf.Bytes())
+
+		cf.Close()
+	}
+}
+
+func Test_STREAM_WRITER(t *testing.T) {
+	const CHUNK = 97
+	b := GenBuffer(CHUNK * 100) // crosses the mini stream cutoff
+
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+	sm, err := cf.RootStorage().AddStream("MyStream")
+	assert.NoError(t, err)
+	err = sm.SetData(GenBuffer(20000))
+	assert.NoError(t, err)
+
+	w := sm.Writer()
+	for i := 0; i < len(b); i += CHUNK {
+		n, err := w.Write(b[i : i+CHUNK])
+		assert.NoError(t, err)
+		assert.Equal(t, CHUNK, n)
+		assert.Equal(t, int64(i+CHUNK), sm.Size())
+	}
+	assert.NoError(t, w.Close())
+	_, err = w.Write(b)
+	assert.Error(t, err)
+
+	data, err := sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, b, data)
+}
+
+func Test_STREAM_APPEND(t *testing.T) {
+	b := GenBuffer(9000)
+
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+	sm, err := cf.RootStorage().AddStream("MyStream")
+	assert.NoError(t, err)
+
+	for _, part := range [][]byte{b[:10], b[10:2000], b[2000:5000], b[5000:5001], b[5001:]} {
+		err = sm.Append(part)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(len(b)), sm.Size())
+
+	data, err := sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, b, data)
+}
+
+func Test_STREAM_WRITE_AT(t *testing.T) {
+	for _, size := range []int{1000, 20000} {
+		b := GenBuffer(size)
+
+		cf, err := mcdf.New(3)
+		assert.NoError(t, err)
+		sm, err := cf.RootStorage().AddStream("MyStream")
+		assert.NoError(t, err)
+		err = sm.SetData(b)
+		assert.NoError(t, err)
+
+		patch := GetBuffer(300, 0xAB)
+		n, err := sm.WriteAt(patch, 500)
+		assert.NoError(t, err)
+		assert.Equal(t, len(patch), n)
+		copy(b[500:], patch)
+
+		n, err = sm.WriteAt(patch, int64(size-100))
+		assert.NoError(t, err)
+		assert.Equal(t, len(patch), n)
+		b = append(b[:size-100], patch...)
+
+		_, err = sm.WriteAt(patch, int64(len(b)+10))
+		assert.NoError(t, err)
+		b = append(b, make([]byte, 10)...)
+		b = append(b, patch...)
+
+		assert.Equal(t, int64(len(b)), sm.Size())
+		data, err := sm.GetData()
+		assert.NoError(t, err)
+		assert.Equal(t, b, data)
+
+		cf.Close()
+	}
+}
+
+func Test_STREAM_TRUNCATE(t *testing.T) {
+	b := GenBuffer(30000)
+
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+	sm, err := cf.RootStorage().AddStream("MyStream")
+	assert.NoError(t, err)
+	err = sm.SetData(b)
+	assert.NoError(t, err)
+
+	// regular -> regular, regular -> mini, mini -> mini, mini -> regular
+	for _, size := range []int{10000, 3000, 100, 5000, 0, 70} {
+		err = sm.Truncate(int64(size))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size), sm.Size())
+
+		if size > len(b) {
+			b = append(b, make([]byte, size-len(b))...)
+		}
+		b = b[:size]
+		data, err := sm.GetData()
+		assert.NoError(t, err)
+		assert.Equal(t, len(b), len(data))
+		if len(b) > 0 {
+			assert.Equal(t, b, data)
+		}
+	}
+}
+
+func Test_STREAM_TRUNCATE_SHRUNK(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+	sm, err := cf.RootStorage().AddStream("MyStream")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(GenBuffer(100000)))
+	b := GenBuffer(10000)
+	assert.NoError(t, sm.SetData(b))
+
+	assert.NoError(t, sm.Truncate(5000))
+	data, err := sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, b[:5000], data)
+
+	// mini stream
+	assert.NoError(t, sm.SetData(GenBuffer(3000)))
+	b = GenBuffer(1000)
+	assert.NoError(t, sm.SetData(b))
+	assert.NoError(t, sm.Truncate(300))
+	data, err = sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, b[:300], data)
+}
+
+func Test_STREAM_READ_AT_PARALLEL(t *testing.T) {
+	cf, err := mcdf.OpenFile("files/report.xls", mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	for _, name := range []string{"Workbook", "\x05SummaryInformation"} {
+		sm, err := cf.RootStorage().GetStream(name)
+		assert.NoError(t, err)
+		want, err := sm.GetData()
+		assert.NoError(t, err)
+
+		// Run with -race: ReadAt must not share a chain position
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				other, _ := cf.RootStorage().GetStream(name)
+				part := make([]byte, 100)
+				for off := int64(g * 37); off < int64(len(want)); off += 700 {
+					n, err := sm.ReadAt(part, off)
+					if err != nil && err != io.EOF {
+						t.Error(err)
+						return
+					}
+					if !bytes.Equal(want[off:off+int64(n)], part[:n]) {
+						t.Errorf("%q differs at %d", name, off)
+						return
+					}
+				}
+				// Sequential reads through a handle of the same entry
+				data, err := ioutil.ReadAll(other)
+				if err != nil || !bytes.Equal(want, data) {
+					t.Errorf("%q read through another handle differs: %v", name, err)
+				}
+			}(g)
+		}
+		wg.Wait()
+	}
+}
+
+func Test_STREAM_READ_AFTER_WRITE(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+	sm, err := cf.RootStorage().AddStream("MyStream")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(GetBuffer(20000, 1)))
+
+	part := make([]byte, 1000)
+	_, err = sm.Seek(15000, io.SeekStart)
+	assert.NoError(t, err)
+	_, err = io.ReadFull(sm, part)
+	assert.NoError(t, err)
+
+	// The chain changes through another handle
+	other, err := cf.RootStorage().GetStream("MyStream")
+	assert.NoError(t, err)
+	assert.NoError(t, other.SetData(GetBuffer(30000, 2)))
+	_, err = io.ReadFull(sm, part)
+	assert.NoError(t, err)
+	assert.Equal(t, GetBuffer(1000, 2), part)
+}
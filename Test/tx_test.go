@@ -0,0 +1,134 @@
+package Test
+
+import (
+	"bytes"
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func image(t *testing.T, cf *mcdf.CompoundFile) []byte {
+	var buf bytes.Buffer
+	_, err := cf.WriteTo(&buf)
+	assert.NoError(t, err)
+	return buf.Bytes()
+}
+
+func Test_TX_ROLLBACK(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+	root := cf.RootStorage()
+
+	big, err := cf.CreateStream("Data/Big", mcdf.MkParents)
+	assert.NoError(t, err)
+	bigData := GenBuffer(10000)
+	assert.NoError(t, big.SetData(bigData))
+	sm, err := cf.CreateStream("Data/Small")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(GenBuffer(200)))
+	before := image(t, cf)
+
+	tx, err := cf.Begin()
+	assert.NoError(t, err)
+	_, err = cf.Begin()
+	assert.Equal(t, mcdf.ErrTxActive, err)
+
+	_, err = big.WriteAt(GetBuffer(600, 0x11), 700)
+	assert.NoError(t, err)
+	assert.NoError(t, big.Append(GenBuffer(5000)))
+	sm, err = cf.CreateStream("Other/New", mcdf.MkParents)
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(GenBuffer(9000)))
+	assert.NoError(t, cf.RemoveAll("Data/Small"))
+	assert.NoError(t, root.SetCLSID([16]byte{1}))
+	assert.NoError(t, root.Rename("Data", "Renamed"))
+	assert.NotEqual(t, before, image(t, cf))
+
+	assert.NoError(t, tx.Rollback())
+	assert.Equal(t, mcdf.ErrTxDone, tx.Rollback())
+	assert.Equal(t, mcdf.ErrTxDone, tx.Commit())
+	assert.Equal(t, before, image(t, cf))
+
+	// Streams from before Begin still work
+	data, err := big.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, bigData, data)
+	assert.False(t, cf.Exists("Other"))
+	assert.True(t, cf.Exists("Data/Small"))
+}
+
+func Test_TX_COMMIT(t *testing.T) {
+	const filename = "files/reportTx.xls"
+	_, err := Copy("files/report.xls", filename)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+
+	cf, err := mcdf.Open(filename)
+	assert.NoError(t, err)
+	before := image(t, cf)
+
+	// Rolling back a conversion restores the old layout
+	tx, err := cf.Begin()
+	assert.NoError(t, err)
+	assert.NoError(t, cf.ConvertTo(4))
+	_, err = cf.Compact()
+	assert.NoError(t, err)
+	assert.Equal(t, mcdf.ErrTxActive, cf.Commit())
+	assert.NoError(t, tx.Rollback())
+	assert.Equal(t, 3, cf.Version())
+	assert.Equal(t, before, image(t, cf))
+
+	tx, err = cf.Begin()
+	assert.NoError(t, err)
+	sm, err := cf.CreateStream("Added")
+	assert.NoError(t, err)
+	added := GenBuffer(3000)
+	assert.NoError(t, sm.SetData(added))
+	assert.NoError(t, tx.Commit())
+	assert.NoError(t, cf.Commit())
+	cf.Close()
+
+	verifyStreams(t, filename, map[string][]byte{"Added": added})
+}
+
+func Test_TX_ROLLBACK_STORAGE(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	st, err := cf.MkdirAll("Dir")
+	assert.NoError(t, err)
+	one, err := st.AddStream("One")
+	assert.NoError(t, err)
+	assert.NoError(t, one.SetData(GenBuffer(100)))
+	before := image(t, cf)
+
+	// The storage was obtained before Begin and is used after Rollback
+	tx, err := cf.Begin()
+	assert.NoError(t, err)
+	_, err = st.AddStream("Two")
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Rollback())
+	assert.Equal(t, before, image(t, cf))
+
+	var names []string
+	for _, e := range entries(t, st) {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"One"}, names)
+	_, err = st.GetStream("Two")
+	assert.Equal(t, mcdf.StreamNotFound, err)
+
+	three, err := st.AddStream("Three")
+	assert.NoError(t, err)
+	assert.NoError(t, three.SetData(GenBuffer(200)))
+	cf2, err := mcdf.OpenBytes(image(t, cf), mcdf.OpenOptions{ValidateTrees: true})
+	if assert.NoError(t, err) {
+		defer cf2.Close()
+		assert.True(t, cf2.Exists("Dir/One"))
+		assert.True(t, cf2.Exists("Dir/Three"))
+		assert.False(t, cf2.Exists("Dir/Two"))
+	}
+}
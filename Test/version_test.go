@@ -0,0 +1,261 @@
+package Test
+
+import (
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_VERSION_4_ROUND_TRIP(t *testing.T) {
+	const filename = "files/VERSION_4_ROUND_TRIP.cfs"
+
+	b1 := GenBuffer(1500)
+	b2 := GenBuffer(70000)
+
+	cf, err := mcdf.New(4)
+	assert.NoError(t, err)
+	assert.Equal(t, 4096, cf.SectorSize())
+	st, err := cf.RootStorage().AddStorage("MyStorage")
+	assert.NoError(t, err)
+	sm, err := st.AddStream("MyMiniStream")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(b1))
+	sm, err = cf.RootStorage().AddStream("MyStream")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(b2))
+	err = cf.Save(filename)
+	assert.NoError(t, err)
+	cf.Close()
+
+	// The header is padded to a whole sector
+	b, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.True(t, len(b)%4096 == 0)
+	assert.Equal(t, make([]byte, 4096-mcdf.HeaderSize), b[mcdf.HeaderSize:4096])
+
+	cf, err = mcdf.Open(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, cf.Version())
+	st, err = cf.RootStorage().GetStorage("MyStorage")
+	assert.NoError(t, err)
+	sm, err = st.GetStream("MyMiniStream")
+	assert.NoError(t, err)
+	data, err := sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, b1, data)
+
+	// Incremental commit on a version 4 file
+	b3 := GenBuffer(9000)
+	sm, err = cf.RootStorage().GetStream("MyStream")
+	assert.NoError(t, err)
+	data, err = sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, b2, data)
+	_, err = sm.WriteAt(b3, 60000)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.Commit())
+	cf.Close()
+
+	cf, err = mcdf.Open(filename)
+	assert.NoError(t, err)
+	sm, err = cf.RootStorage().GetStream("MyStream")
+	assert.NoError(t, err)
+	data, err = sm.GetData()
+	assert.NoError(t, err)
+	copy(b2[60000:], b3)
+	assert.Equal(t, b2, data)
+	cf.Close()
+
+	if _, err := os.Stat(filename); err == nil {
+		err = os.Remove(filename)
+		assert.NoError(t, err)
+	}
+}
+
+func Test_VERSION_4_CREATE(t *testing.T) {
+	const filename = "files/VERSION_4_CREATE.cfs"
+
+	b := GenBuffer(20000)
+
+	cf, err := mcdf.Create(filename, 4)
+	assert.NoError(t, err)
+	for i := 0; i < 40; i++ {
+		_, err = cf.RootStorage().AddStream(String(int32(i)))
+		assert.NoError(t, err)
+	}
+	sm, err := cf.RootStorage().GetStream("39")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(b))
+	assert.NoError(t, cf.Commit())
+	cf.Close()
+
+	cf, err = mcdf.Open(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, cf.Version())
+	sm, err = cf.RootStorage().GetStream("39")
+	assert.NoError(t, err)
+	data, err := sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, b, data)
+	cf.Close()
+
+	if _, err := os.Stat(filename); err == nil {
+		err = os.Remove(filename)
+		assert.NoError(t, err)
+	}
+}
+
+// files/v4.cfs is written by files/gen_v4.go, not by this package: it has
+// 4096-byte sectors, a mini stream and a stream below a storage.
+func Test_VERSION_4_SAMPLE(t *testing.T) {
+	const srcFilename = "files/v4.cfs"
+	const dstFilename = "files/VERSION_4_SAMPLE.cfs"
+
+	pattern := func(n, k int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(i * k)
+		}
+		return b
+	}
+	streams := map[string][]byte{
+		"Mini":               pattern(300, 3),
+		"Small":              pattern(100, 5),
+		"MyStorage/MyStream": pattern(10000, 7),
+	}
+	verify := func(filename string) {
+		cf, err := mcdf.OpenFile(filename, mcdf.OpenOptions{ValidateTrees: true})
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer cf.Close()
+		assert.Equal(t, 4, cf.Version())
+		assert.Equal(t, 4096, cf.SectorSize())
+		for name, b := range streams {
+			sm, err := cf.OpenStream(name)
+			if !assert.NoError(t, err, name) {
+				continue
+			}
+			data, err := sm.GetData()
+			assert.NoError(t, err, name)
+			assert.Equal(t, b, data, name)
+		}
+		st, err := cf.OpenStorage("MyStorage")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2019, 4, 17, 18, 40, 0, 0, time.UTC), st.Modified())
+	}
+	verify(srcFilename)
+
+	_, err := Copy(srcFilename, dstFilename)
+	assert.NoError(t, err)
+	defer os.Remove(dstFilename)
+	cf, err := mcdf.Open(dstFilename)
+	assert.NoError(t, err)
+	sm, err := cf.OpenStream("MyStorage/MyStream")
+	assert.NoError(t, err)
+	patch := GetBuffer(5000, 0x42)
+	_, err = sm.WriteAt(patch, 8000)
+	assert.NoError(t, err)
+	streams["MyStorage/MyStream"] = append(streams["MyStorage/MyStream"][:8000], patch...)
+	streams["New"] = GenBuffer(20000)
+	sm, err = cf.CreateStream("New")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(streams["New"]))
+	streams["Small"] = GenBuffer(2000)
+	sm, err = cf.OpenStream("Small")
+	assert.NoError(t, err)
+	assert.NoError(t, sm.SetData(streams["Small"]))
+	assert.NoError(t, cf.Commit())
+	cf.Close()
+	verify(dstFilename)
+}
+
+func Test_CONVERT_VERSION(t *testing.T) {
+	const srcFilename = "files/report.xls"
+	const dstFilename = "files/reportConvert.xls"
+
+	names := []string{"Workbook", "\x05SummaryInformation", "\x05DocumentSummaryInformation"}
+	streams := make(map[string][]byte)
+
+	cf, err := mcdf.Open(srcFilename)
+	assert.NoError(t, err)
+	for _, name := range names {
+		sm, err := cf.RootStorage().GetStream(name)
+		assert.NoError(t, err)
+		streams[name], err = sm.GetData()
+		assert.NoError(t, err)
+	}
+
+	for _, ver := range []int{4, 3} {
+		err = cf.ConvertTo(ver)
+		assert.NoError(t, err)
+		assert.Equal(t, ver, cf.Version())
+		err = cf.Save(dstFilename)
+		assert.NoError(t, err)
+
+		cf2, err := mcdf.Open(dstFilename)
+		assert.NoError(t, err)
+		assert.Equal(t, ver, cf2.Version())
+		for _, name := range names {
+			sm, err := cf2.RootStorage().GetStream(name)
+			assert.NoError(t, err)
+			data, err := sm.GetData()
+			assert.NoError(t, err)
+			assert.Equal(t, streams[name], data, name)
+		}
+		cf2.Close()
+	}
+	cf.Close()
+
+	// A file opened from disk is rewritten by Commit
+	cf, err = mcdf.Open(dstFilename)
+	assert.NoError(t, err)
+	assert.NoError(t, cf.ConvertTo(4))
+	assert.NoError(t, cf.Commit())
+	cf.Close()
+
+	cf, err = mcdf.Open(dstFilename)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, cf.Version())
+	sm, err := cf.RootStorage().GetStream("Workbook")
+	assert.NoError(t, err)
+	data, err := sm.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, streams["Workbook"], data)
+	cf.Close()
+
+	if _, err := os.Stat(dstFilename); err == nil {
+		err = os.Remove(dstFilename)
+		assert.NoError(t, err)
+	}
+}
+
+func Test_CONVERT_VERSION_PADDING(t *testing.T) {
+	src, err := ioutil.ReadFile("files/report.xls")
+	assert.NoError(t, err)
+	filename := filepath.Join(t.TempDir(), "padding.xls")
+
+	// The v3 sectors after the header are overwritten with zeros
+	for _, durable := range []bool{false, true} {
+		assert.NoError(t, ioutil.WriteFile(filename, src, 0644))
+		cf, err := mcdf.OpenFile(filename, mcdf.OpenOptions{Durable: durable})
+		assert.NoError(t, err)
+		assert.NoError(t, cf.ConvertTo(4))
+		assert.NoError(t, cf.Commit())
+		cf.Close()
+
+		b, err := ioutil.ReadFile(filename)
+		assert.NoError(t, err)
+		if assert.True(t, len(b) >= 4096) {
+			assert.Equal(t, make([]byte, 4096-512), b[512:4096], "durable %v", durable)
+		}
+		cf, err = mcdf.Open(filename)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, cf.Version())
+		cf.Close()
+	}
+}
@@ -0,0 +1,147 @@
+package Test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	mcdf "github.com/AlkBur/openmcdf"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func walkPaths(t *testing.T, cf *mcdf.CompoundFile, skip string, opts ...mcdf.WalkOptions) (paths []string) {
+	err := cf.Walk(func(path string, e mcdf.Entry, err error) error {
+		assert.NoError(t, err)
+		paths = append(paths, path)
+		if path == skip {
+			return mcdf.SkipDir
+		}
+		return nil
+	}, opts...)
+	assert.NoError(t, err)
+	return
+}
+
+func Test_WALK(t *testing.T) {
+	cf, err := mcdf.OpenFile("files/MultipleStorage.cfs", mcdf.OpenOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	defer cf.Close()
+
+	assert.Equal(t, []string{
+		".",
+		"MyStorage",
+		"MyStorage/MyStream",
+		"MyStorage/AnotherStorage",
+		"MyStorage/AnotherStorage/AnotherStream",
+		"MyStorage/MySecondStream",
+	}, walkPaths(t, cf, ""))
+
+	assert.Equal(t, []string{
+		".",
+		"MyStorage",
+		"MyStorage/MyStream",
+		"MyStorage/AnotherStorage",
+		"MyStorage/MySecondStream",
+	}, walkPaths(t, cf, "MyStorage/AnotherStorage"))
+
+	// SkipDir on a stream skips the rest of its storage
+	assert.Equal(t, []string{
+		".",
+		"MyStorage",
+		"MyStorage/MyStream",
+	}, walkPaths(t, cf, "MyStorage/MyStream"))
+
+	assert.Equal(t, []string{".", "MyStorage"}, walkPaths(t, cf, "", mcdf.WalkOptions{MaxDepth: 1}))
+
+	n := 0
+	err = cf.Walk(func(path string, e mcdf.Entry, err error) error {
+		n++
+		return mcdf.SkipAll
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func Test_WALK_LOOP(t *testing.T) {
+	cf, err := mcdf.New(3)
+	assert.NoError(t, err)
+	st, err := cf.RootStorage().AddStorage("S")
+	assert.NoError(t, err)
+	_, err = st.AddStorage("T")
+	assert.NoError(t, err)
+	_, err = st.AddStream("A")
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = cf.WriteTo(&buf)
+	assert.NoError(t, err)
+	cf.Close()
+	img := buf.Bytes()
+
+	s, a, tt := findEntry(img, 'S'), findEntry(img, 'A'), findEntry(img, 'T')
+	if !assert.True(t, s > 0 && a > 0 && tt > 0) {
+		return
+	}
+	// The directory chain starts in one sector here
+	dir := (int(binary.LittleEndian.Uint32(img[48:])) + 1) * 512
+	// The child of T is S, its parent
+	sID := uint32((s - dir) / 128)
+	loop := append([]byte{}, img...)
+	binary.LittleEndian.PutUint32(loop[tt+76:], sID)
+	cf, err = mcdf.OpenBytes(loop)
+	assert.NoError(t, err)
+	var reported []string
+	err = cf.Walk(func(path string, e mcdf.Entry, err error) error {
+		if err != nil {
+			assert.True(t, errors.Is(err, mcdf.ErrDirectoryLoop))
+			reported = append(reported, path)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"S/T/S"}, reported)
+	cf.Close()
+
+	// A sibling id of A pointing to itself
+	aID := uint32((a - dir) / 128)
+	loop = append([]byte{}, img...)
+	binary.LittleEndian.PutUint32(loop[a+68:], aID)
+	cf, err = mcdf.OpenBytes(loop)
+	assert.NoError(t, err)
+	reported = nil
+	err = cf.Walk(func(path string, e mcdf.Entry, err error) error {
+		if err != nil {
+			assert.True(t, errors.Is(err, mcdf.ErrDirectoryLoop))
+			reported = append(reported, path)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"S"}, reported)
+
+	// A storage with a loop is not changed
+	st, err = cf.RootStorage().GetStorage("S")
+	assert.NoError(t, err)
+	_, err = st.AddStream("B")
+	assert.True(t, errors.Is(err, mcdf.ErrDirectoryLoop))
+	_, err = st.AddStorage("U")
+	assert.True(t, errors.Is(err, mcdf.ErrDirectoryLoop))
+	err = st.Delete("T", mcdf.DeleteOptions{Recursive: true})
+	assert.True(t, errors.Is(err, mcdf.ErrDirectoryLoop))
+	err = cf.RootStorage().Move("S", st, "S2")
+	assert.True(t, errors.Is(err, mcdf.ErrDirectoryLoop))
+	list, err := st.Entries()
+	assert.True(t, errors.Is(err, mcdf.ErrDirectoryLoop))
+	assert.Equal(t, 2, len(list))
+	var listed []string
+	for e, err := range st.All() {
+		if err != nil {
+			assert.True(t, errors.Is(err, mcdf.ErrDirectoryLoop))
+			listed = append(listed, "error")
+		} else {
+			listed = append(listed, e.Name())
+		}
+	}
+	assert.Equal(t, 3, len(listed))
+	assert.Equal(t, "error", listed[2])
+	cf.Close()
+}
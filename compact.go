@@ -0,0 +1,84 @@
+package openmcdf
+
+// CompactStats describes the effect of Compact.
+type CompactStats struct {
+	// SizeBefore and SizeAfter are the sizes of the file image in bytes.
+	SizeBefore, SizeAfter int64
+	// FragmentationBefore and FragmentationAfter are the share of links in
+	// the stream chains (including the mini stream) that do not point to the
+	// physically following sector: 0 for a fully contiguous file.
+	FragmentationBefore, FragmentationAfter float64
+}
+
+// Reclaimed returns the number of bytes the compaction freed.
+func (this CompactStats) Reclaimed() int64 {
+	return this.SizeBefore - this.SizeAfter
+}
+
+// Compact lays the compound file out again in the minimum number of
+// sectors: free sectors are dropped, every stream chain and the mini
+// stream become contiguous, the mini stream holds only live mini sectors
+// and the directory only live entries. A file opened from disk is
+// rewritten, and shrunk, by the next Commit. Storages and streams obtained
+// before the compaction must not be used afterwards.
+func (this *CompoundFile) Compact() (stats CompactStats, err error) {
+	if this == nil || this.header == nil {
+		err = WrongFormat
+		return
+	}
+	if err = this.checkWritable(); err != nil {
+		return
+	}
+	stats.SizeBefore = this.size()
+	if stats.FragmentationBefore, err = this.fragmentation(); err != nil {
+		return
+	}
+	var dst *CompoundFile
+	if dst, err = this.rebuild(this.Version()); err != nil {
+		return
+	}
+	this.replace(dst)
+	stats.SizeAfter = this.size()
+	stats.FragmentationAfter, err = this.fragmentation()
+	return
+}
+
+// size returns the size of the file image in bytes.
+func (this *CompoundFile) size() int64 {
+	return int64(this.sectors.Len()+1) * int64(this.SectorSize())
+}
+
+// fragmentation returns the share of stream chain links that are not
+// contiguous, see CompactStats.
+func (this *CompoundFile) fragmentation() (float64, error) {
+	var links, breaks int
+	for _, de := range this.directory.data {
+		if de.objectType != StgStream && de.objectType != StgRoot {
+			continue
+		}
+		mini := de.isMini(this)
+		limit := this.sectors.Len()
+		if mini {
+			limit = this.mini.Len()
+		}
+		SecID := int32(de.startSectorLocation)
+		for i := 0; SecID >= 0 && i < limit; i++ {
+			next, err := this.nextSector(SecID, mini)
+			if err != nil {
+				return 0, err
+			}
+			if next < 0 {
+				break
+			}
+			links++
+			if next != SecID+1 {
+				breaks++
+			}
+			SecID = next
+		}
+	}
+	if links == 0 {
+		return 0, nil
+	}
+	return float64(breaks) / float64(links), nil
+}
@@ -0,0 +1,305 @@
+package openmcdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ConvertTo lays the compound file out again with the sector size of the
+// given major version (3 or 4). The FAT, DIFAT, directory and mini stream
+// are rebuilt; every storage and stream keeps its data, CLSID, state bits
+// and timestamps. A file opened from disk is rewritten by the next Commit.
+// Storages and streams obtained before the conversion must not be used
+// afterwards.
+func (this *CompoundFile) ConvertTo(ver int) (err error) {
+	if this == nil || this.header == nil {
+		return WrongFormat
+	}
+	if err = this.checkWritable(); err != nil {
+		return
+	}
+	if ver == this.Version() {
+		return
+	}
+	var dst *CompoundFile
+	if dst, err = this.rebuild(ver); err != nil {
+		return
+	}
+	this.replace(dst)
+	return
+}
+
+// rebuild returns an in-memory compound file of the given version with
+// the same entries as this one. The directory is built first and the FAT
+// and mini FAT tables are reserved up front, so the mini stream and every
+// stream chain end up contiguous.
+func (this *CompoundFile) rebuild(ver int) (dst *CompoundFile, err error) {
+	if dst, err = New(ver); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			dst = nil
+		}
+	}()
+
+	var streams []streamCopy
+	copyAttributes(this.root.de, dst.root.de)
+	if err = dst.updateDirectory(dst.root.de); err != nil {
+		return
+	}
+	if streams, _, err = this.root.copyEntries(dst.root, "", nil); err != nil {
+		return
+	}
+	if err = dst.reserveTables(streams); err != nil {
+		return
+	}
+	//The mini stream first, then the regular streams
+	for _, mini := range []bool{true, false} {
+		for _, c := range streams {
+			if c.src.de.isMini(this) == mini {
+				if err = c.src.copyData(c.dst); err != nil {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// reserveTables adds the FAT and mini FAT sectors needed to hold the given
+// streams, so that no table sector is allocated between data sectors.
+func (this *CompoundFile) reserveTables(streams []streamCopy) (err error) {
+	ss := int64(this.SectorSize())
+	perSector := ss / UInt32Size
+	cutoff := int64(this.header.miniStreamCutoffSize)
+
+	var data, mini int64
+	for _, c := range streams {
+		size := c.src.Size()
+		if size >= cutoff {
+			data += (size + ss - 1) / ss
+		} else {
+			mini += (size + int64(this.MiniSectorSize()) - 1) / int64(this.MiniSectorSize())
+		}
+	}
+	//The mini stream grows by whole sectors
+	miniStream := (mini*int64(this.MiniSectorSize()) + ss - 1) / ss
+	miniTable := (miniStream*(ss/int64(this.MiniSectorSize())) + perSector - 1) / perSector
+
+	used := int64(this.sectors.Len())
+	tables := int64(this.memory.Len(MemoryTableFat))
+	difat := func(fat int64) int64 {
+		if fat <= int64(len(this.header.headerDIFAT)) {
+			return 0
+		}
+		return (fat - int64(len(this.header.headerDIFAT)) + perSector - 2) / (perSector - 1)
+	}
+	fat := tables
+	for {
+		total := used + (fat - tables) + difat(fat) - int64(this.memory.Len(MemoryDIFAT)) +
+			miniTable + miniStream + data
+		need := (total + perSector - 1) / perSector
+		if need <= fat {
+			break
+		}
+		fat = need
+	}
+
+	for i := tables; i < fat; i++ {
+		if _, err = this.addSector(TypeSectorMemmoryFAT); err != nil {
+			return
+		}
+	}
+	for i := int64(this.memory.Len(MemoryTableMini)); i < miniTable; i++ {
+		if _, err = this.addSector(TypeSectorMemmoryMiniFAT); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// replace takes over the layout of src, which must not be used after
+// the call. The file the compound file is bound to is kept, and every
+// sector of the new layout is written on the next Commit.
+func (this *CompoundFile) replace(src *CompoundFile) {
+	f, r, readOnly, tx := this.f, this.r, this.readOnly, this.tx
+	name, durable, wrap := this.name, this.durable, this.wrap
+	this.f, this.r = nil, nil
+	this.Close()
+
+	*this = *src
+	this.f, this.r, this.readOnly, this.tx = f, r, readOnly, tx
+	this.name, this.durable, this.wrap = name, durable, wrap
+	this.header.modified = true
+	this.root = this.root.de.newRootStorage(this)
+}
+
+// CopyTo copies the storage with everything below it into dst as a new
+// storage called name. dst may belong to another compound file, also of a
+// different version; stream data is copied sector by sector, and CLSIDs,
+// state bits and timestamps are kept.
+func (this *Storage) CopyTo(dst *Storage, name string) (err error) {
+	_, err = this.copyTo(dst, name)
+	return
+}
+
+// copyTo is CopyTo that also returns the path, relative to dst, of the
+// entry the copy failed at. A partial copy is removed from dst.
+func (this *Storage) copyTo(dst *Storage, name string) (component string, err error) {
+	if this == nil || dst == nil {
+		return name, errors.New("Storage is nil")
+	}
+	if this.cf == dst.cf && this.cf.contains(this.de, dst.de) {
+		return name, fmt.Errorf("Cannot copy storage %q into itself", this.de.Name())
+	}
+	var st *Storage
+	if st, err = dst.AddStorage(name); err != nil {
+		return name, err
+	}
+	defer func() {
+		if err != nil {
+			//The error of the copy is reported rather than this one
+			_ = dst.Delete(name, DeleteOptions{Recursive: true})
+		}
+	}()
+	copyAttributes(this.de, st.de)
+	if err = dst.cf.updateDirectory(st.de); err != nil {
+		return name, err
+	}
+	var streams []streamCopy
+	if streams, component, err = this.copyEntries(st, name, nil); err != nil {
+		return
+	}
+	for _, c := range streams {
+		if err = c.src.copyData(c.dst); err != nil {
+			return c.path, err
+		}
+	}
+	return "", nil
+}
+
+// CopyEntry copies a stream or storage, which may belong to another
+// compound file, to dstPath, see Storage.CopyTo. The storages on the way
+// to dstPath must exist.
+func (this *CompoundFile) CopyEntry(src Entry, dstPath string) error {
+	elems := splitPath(dstPath)
+	if len(elems) == 0 {
+		return &PathError{Op: "copy", Path: dstPath, Err: ErrExist}
+	}
+	parent, err := this.RootStorage().descend("copy", dstPath, elems[:len(elems)-1], false)
+	if err != nil {
+		return err
+	}
+	name := elems[len(elems)-1]
+	component := name
+	if src.IsStorage() {
+		var st *Storage
+		if st, err = src.Storage(); err == nil {
+			component, err = st.copyTo(parent, name)
+		}
+	} else {
+		var sm *Stream
+		if sm, err = src.Stream(); err == nil {
+			err = sm.copyTo(parent, name)
+		}
+	}
+	if err != nil {
+		if len(elems) > 1 {
+			component = strings.Join(elems[:len(elems)-1], "/") + "/" + component
+		}
+		return &PathError{Op: "copy", Path: dstPath, Component: component, Err: err}
+	}
+	return nil
+}
+
+// copyTo copies the stream into dst as a new stream called name.
+func (this *Stream) copyTo(dst *Storage, name string) (err error) {
+	var sm *Stream
+	if sm, err = dst.AddStream(name); err != nil {
+		return
+	}
+	copyAttributes(this.de, sm.de)
+	if err = dst.cf.updateDirectory(sm.de); err == nil {
+		err = this.copyData(sm)
+	}
+	if err != nil {
+		//The error of the copy is reported rather than this one
+		_ = dst.Delete(name)
+	}
+	return
+}
+
+// streamCopy is a stream whose entry has been created in the destination
+// but whose data is still to be copied.
+type streamCopy struct {
+	src, dst *Stream
+	//path of the stream relative to the storage copied into
+	path string
+}
+
+// copyEntries creates the streams and storages below this storage in dst,
+// recursing into sub-storages, and copies their attributes. The streams
+// are appended to streams; their data is not copied. path is the path of
+// dst, empty for the root; the path of the entry a copy fails at is
+// returned.
+func (this *Storage) copyEntries(dst *Storage, path string, streams []streamCopy) ([]streamCopy, string, error) {
+	var err error
+	if err = this.load(); err != nil {
+		return streams, path, err
+	}
+	for it := this.tree.Iterator(); it != nil; it = it.Next() {
+		de := it.Value
+		component := de.Name()
+		if path != "" {
+			component = path + "/" + component
+		}
+		switch de.objectType {
+		case StgStream:
+			var sm *Stream
+			if sm, err = dst.AddStream(de.Name()); err != nil {
+				return streams, component, err
+			}
+			copyAttributes(de, sm.de)
+			if err = dst.cf.updateDirectory(sm.de); err != nil {
+				return streams, component, err
+			}
+			streams = append(streams, streamCopy{src: de.newStream(this.cf), dst: sm, path: component})
+		case StgStorage:
+			var st *Storage
+			if st, err = dst.AddStorage(de.Name()); err != nil {
+				return streams, component, err
+			}
+			copyAttributes(de, st.de)
+			if err = dst.cf.updateDirectory(st.de); err != nil {
+				return streams, component, err
+			}
+			if streams, component, err = de.newStorage(this.cf).copyEntries(st, component, streams); err != nil {
+				return streams, component, err
+			}
+		}
+	}
+	return streams, "", nil
+}
+
+// copyData copies the data of the stream into dst. The data is streamed
+// sector by sector, so the two streams may live in files with different
+// sector sizes.
+func (this *Stream) copyData(dst *Stream) (err error) {
+	w := dst.Writer()
+	if _, err = io.Copy(w, io.NewSectionReader(this, 0, this.Size())); err != nil {
+		return
+	}
+	return w.Close()
+}
+
+// copyAttributes copies the CLSID, state bits and timestamps of an entry.
+func copyAttributes(src, dst *Directory) {
+	dst.clsid = src.clsid
+	dst.stateBits = src.stateBits
+	dst.creationTime = src.creationTime
+	dst.modifiedTime = src.modifiedTime
+}
@@ -2,12 +2,14 @@ package openmcdf
 
 import (
 	"bytes"
-	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode"
 	"unicode/utf16"
 )
 
@@ -52,7 +54,21 @@ type Directory struct {
 	startSectorLocation uint32
 	size                uint64
 	//---------
-	id int
+	id  int
+	pos chainPos
+	//set anew by resetChain, so positions kept elsewhere are dropped too
+	chainGen int64
+}
+
+// chainPos remembers the last sector reached in the stream chain, so
+// sequential access does not walk the chain from its start every time.
+// Writes use the position of the entry; readers keep their own, so that
+// reading does not change shared state.
+type chainPos struct {
+	index int
+	id    int32
+	gen   int64
+	valid bool
 }
 
 //--------------Directory collection--------------
@@ -196,13 +212,18 @@ func (this *DirectoryCollection) New(cf *CompoundFile, name string, objectType u
 			return nil, fmt.Errorf("Error allocated directory memory")
 		}
 	}
-	t := time.Now()
 	err := de.SetName(name)
 	de.objectType = objectType
-	de.newGUID()
 	de.colorFlag = Black
-	de.setTimeCreate(t)
-	de.setTimeModification(t)
+	//Streams carry no times and the root entry no creation time
+	t := time.Now()
+	switch objectType {
+	case StgStorage:
+		de.setTimeCreate(t)
+		de.setTimeModification(t)
+	case StgRoot:
+		de.setTimeModification(t)
+	}
 
 	return de, err
 }
@@ -267,6 +288,7 @@ func (this *Directory) clear() {
 	this.modifiedTime = 0
 	this.startSectorLocation = ENDOFCHAIN
 	this.size = 0
+	this.resetChain()
 }
 
 func (this *Directory) setObjectType(objectType uint8) error {
@@ -354,7 +376,7 @@ func (this *Directory) Name() string {
 }
 
 func (this *Directory) read(b []byte) (err error) {
-	defer RecoverError(err)
+	defer RecoverError(&err)
 
 	r := bytes.NewBuffer(b)
 	//Read 128 bytes
@@ -367,8 +389,8 @@ func (this *Directory) read(b []byte) (err error) {
 	check(ReadData(r, &this.childID))             //4 byte
 	check(ReadData(r, this.clsid[:]))             //16 byte
 	check(ReadData(r, &this.stateBits))           //4 byte
-	check(ReadData(r, this.creationTime))         //8 byte
-	check(ReadData(r, this.modifiedTime))         //8 byte
+	check(ReadData(r, &this.creationTime))        //8 byte
+	check(ReadData(r, &this.modifiedTime))        //8 byte
 	check(ReadData(r, &this.startSectorLocation)) //4 byte
 	check(ReadData(r, &this.size))                //8 byte
 
@@ -376,15 +398,45 @@ func (this *Directory) read(b []byte) (err error) {
 }
 
 func (this *Directory) compareTo(otherDir *Directory) int {
-	return strings.Compare(this.Name(), otherDir.Name())
+	return compareNames(this.Name(), otherDir.Name())
+}
+
+// compareNames orders entry names as MS-CFB requires: the shorter UTF-16
+// name first, then code unit by code unit after converting to upper case.
+func compareNames(a, b string) int {
+	return compareKeys(nameKey(a), nameKey(b))
 }
 
-func (this *Directory) newGUID() {
-	rand.Read(this.clsid[:])
-	//Set version 4
-	this.clsid[6] = (this.clsid[6] & 0x0f) | (4 << 4)
-	//Set variant Microsoft
-	this.clsid[8] = (this.clsid[8]&(0xff>>3) | (0x06 << 5))
+// nameKey returns the upper-case UTF-16 form of a name used to compare it.
+func nameKey(name string) []uint16 {
+	key := utf16.Encode([]rune(name))
+	for i, c := range key {
+		if utf16.IsSurrogate(rune(c)) {
+			continue
+		}
+		if u := unicode.ToUpper(rune(c)); u <= 0xFFFF {
+			key[i] = uint16(u)
+		}
+	}
+	return key
+}
+
+func compareKeys(a, b []uint16) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
 }
 
 func (this *Directory) newStream(cf *CompoundFile) *Stream {
@@ -409,7 +461,7 @@ func (this *Directory) newRootStorage(cf *CompoundFile) *Storage {
 }
 
 func (this *Directory) Bytes() (b []byte, err error) {
-	defer RecoverError(err)
+	defer RecoverError(&err)
 
 	buf := new(bytes.Buffer)
 
@@ -454,6 +506,7 @@ func (this *Directory) Write(cf *CompoundFile, b []byte) (err error) {
 		return
 	}
 
+	this.resetChain()
 	OldSize := int(this.size)
 	NewSize := len(b)
 
@@ -476,7 +529,7 @@ func (this *Directory) Write(cf *CompoundFile, b []byte) (err error) {
 
 	//Change directory
 	updateDE := false
-	if OldSize != NewSize {
+	if this.size != uint64(NewSize) {
 		this.size = uint64(NewSize)
 		updateDE = true
 	}
@@ -521,12 +574,14 @@ func (this *Directory) Write(cf *CompoundFile, b []byte) (err error) {
 				old = s
 				SecID = int32(s.next)
 			}
+			//The chain ends at the last sector written
+			SecID = int32(s.next)
+			s.next = ENDOFCHAIN
 			if err = cf.memory.changeFAT(s); err != nil {
 				return
 			}
 			//clear
-			SecID = int32(s.next)
-			if SecID > 0 && offset < OldSize {
+			if SecID >= 0 && offset < OldSize {
 				if err = cf.FreeFAT(SecID, OldSize-offset); err != nil {
 					return
 				}
@@ -556,7 +611,7 @@ func (this *Directory) Write(cf *CompoundFile, b []byte) (err error) {
 					}
 				}
 				if s.sector.data == nil {
-					if err = s.sector.read(cf.f); err != nil {
+					if err = s.sector.read(cf.r); err != nil {
 						return
 					}
 				}
@@ -567,12 +622,14 @@ func (this *Directory) Write(cf *CompoundFile, b []byte) (err error) {
 				old = s
 				SecID = int32(s.next)
 			}
+			//The chain ends at the last sector written
+			SecID = int32(s.next)
+			s.next = ENDOFCHAIN
 			if err = cf.memory.changeMiniFAT(s); err != nil {
 				return
 			}
 			//clear
-			SecID = int32(s.next)
-			if SecID > 0 && offset < OldSize {
+			if SecID >= 0 && offset < OldSize {
 				if err = cf.FreeMiniFAT(SecID, OldSize-offset); err != nil {
 					return
 				}
@@ -587,51 +644,388 @@ func (this *Directory) Write(cf *CompoundFile, b []byte) (err error) {
 	return
 }
 
-func (this *Directory) Read(cf *CompoundFile) (b []byte, err error) {
-	if int64(this.size) <= 0 {
+// Append adds b to the end of the stream data. Only the last sector of the
+// chain and the newly allocated sectors are written.
+func (this *Directory) Append(cf *CompoundFile, b []byte) (err error) {
+	if this == nil {
+		err = errors.New("Error append in directory: directory is nil")
 		return
-	} else if int32(this.startSectorLocation) < 0 {
-		err = fmt.Errorf("Start location is error in directory: %v", this.startSectorLocation)
+	}
+	if len(b) == 0 {
 		return
 	}
-	b = make([]byte, this.size)
-	if len(b) < int(cf.header.miniStreamCutoffSize) {
-		//Mini sector FAT
+	OldSize := int64(this.size)
+	NewSize := OldSize + int64(len(b))
+	cutoff := int64(cf.header.miniStreamCutoffSize)
+	if OldSize == 0 || (OldSize < cutoff && NewSize >= cutoff) {
+		//Leaving the mini stream rewrites less than cutoff bytes
+		var old []byte
+		if old, err = this.Read(cf); err != nil {
+			return
+		}
+		return this.Write(cf, append(old, b...))
+	}
+
+	var SecID int32
+	if this.isMini(cf) {
 		var s *MiniSector
+		sz := int64(cf.MiniSectorSize())
+		index := int((OldSize - 1) / sz)
+		if SecID, err = this.seekChain(cf, index); err != nil {
+			return
+		}
+		if s, err = cf.mini.Get(int(SecID)); err != nil {
+			return
+		}
+		err = this.extendMiniChain(cf, s, index, int(OldSize-int64(index)*sz), b)
+	} else {
+		var s *Sector
+		sz := int64(cf.SectorSize())
+		index := int((OldSize - 1) / sz)
+		if SecID, err = this.seekChain(cf, index); err != nil {
+			return
+		}
+		if s, err = cf.sectors.Get(SecID); err != nil {
+			return
+		}
+		err = this.extendChain(cf, s, index, int(OldSize-int64(index)*sz), b)
+	}
+	if err != nil {
+		return
+	}
+	this.size = uint64(NewSize)
+	return cf.updateDirectory(this)
+}
 
-		//Start read
-		SecID := int32(this.startSectorLocation)
-		offset := 0
-		for offset < len(b) {
+// WriteAt overwrites the stream data at off with b. Only the sectors
+// covering the range are written; the chain is extended when the range
+// goes past the end of the stream.
+func (this *Directory) WriteAt(cf *CompoundFile, b []byte, off int64) (err error) {
+	if this == nil {
+		err = errors.New("Error write in directory: directory is nil")
+		return
+	}
+	if off < 0 {
+		return fmt.Errorf("Negative offset in directory: %v", off)
+	}
+	size := int64(this.size)
+	if off >= size {
+		if err = this.Truncate(cf, off); err != nil {
+			return
+		}
+		return this.Append(cf, b)
+	}
+	tail := []byte(nil)
+	if int64(len(b)) > size-off {
+		b, tail = b[:size-off], b[size-off:]
+	}
+
+	mini := this.isMini(cf)
+	sz := int64(cf.SectorSize())
+	if mini {
+		sz = int64(cf.MiniSectorSize())
+	}
+	for n := 0; n < len(b); {
+		var m int
+		var SecID int32
+		cur := off + int64(n)
+		if SecID, err = this.seekChain(cf, int(cur/sz)); err != nil {
+			return
+		}
+		if mini {
+			var s *MiniSector
 			if s, err = cf.mini.Get(int(SecID)); err != nil {
 				return
 			}
-			if err = s.Read(cf.f, b[offset:]); err != nil {
+			if s.sector.data == nil {
+				if err = s.sector.read(cf.r); err != nil {
+					return
+				}
+			}
+			m, err = s.writeAt(int(cur%sz), b[n:])
+		} else {
+			var s *Sector
+			if s, err = cf.sectors.Get(SecID); err != nil {
+				return
+			}
+			if s.data == nil {
+				if err = s.read(cf.r); err != nil {
+					return
+				}
+			}
+			m, err = s.writeAt(int(cur%sz), b[n:])
+		}
+		if err != nil {
+			return
+		}
+		n += m
+	}
+	return this.Append(cf, tail)
+}
+
+// Truncate changes the size of the stream data. A shorter stream gives
+// the tail of its chain back to the FAT or mini FAT, a longer one is
+// filled with zeros. The data moves between the mini stream and regular
+// sectors when the new size crosses the mini stream cutoff size.
+func (this *Directory) Truncate(cf *CompoundFile, size int64) (err error) {
+	if this == nil {
+		err = errors.New("Error truncate directory: directory is nil")
+		return
+	}
+	if size < 0 {
+		return fmt.Errorf("Error truncate directory: negative size %v", size)
+	}
+	OldSize := int64(this.size)
+	cutoff := int64(cf.header.miniStreamCutoffSize)
+	switch {
+	case size == OldSize:
+		return
+	case size > OldSize:
+		zero := make([]byte, 64*1024)
+		for grow := size - OldSize; grow > 0; {
+			n := int64(len(zero))
+			if n > grow {
+				n = grow
+			}
+			if err = this.Append(cf, zero[:n]); err != nil {
+				return
+			}
+			grow -= n
+		}
+		return
+	case size == 0 || (OldSize >= cutoff && size < cutoff):
+		//Write moves the data to the mini stream and frees the old chain
+		b := make([]byte, size)
+		if _, err = this.ReadAt(cf, b, 0, &chainPos{}); err != nil {
+			return
+		}
+		return this.Write(cf, b)
+	}
+
+	var SecID int32
+	mini := this.isMini(cf)
+	sz := int64(cf.SectorSize())
+	if mini {
+		sz = int64(cf.MiniSectorSize())
+	}
+	if SecID, err = this.seekChain(cf, int((size-1)/sz)); err != nil {
+		return
+	}
+	this.resetChain()
+	if mini {
+		var s *MiniSector
+		if s, err = cf.mini.Get(int(SecID)); err != nil {
+			return
+		}
+		next := int32(s.next)
+		s.next = ENDOFCHAIN
+		if err = cf.memory.changeMiniFAT(s); err != nil {
+			return
+		}
+		if next >= 0 {
+			if err = cf.FreeMiniFAT(next, int(OldSize-size)); err != nil {
 				return
 			}
-			offset += s.size
-			SecID = int32(s.next)
 		}
 	} else {
-		//Sector FAT
 		var s *Sector
-		SecID := int32(this.startSectorLocation)
-		if SecID <= 0 {
-			err = fmt.Errorf("Start location is error in directory: %v", SecID)
+		if s, err = cf.sectors.Get(SecID); err != nil {
 			return
 		}
-		offset := 0
-		for offset < len(b) {
-			s, err = cf.sectors.Get(SecID)
-			if err != nil {
+		next := int32(s.next)
+		s.next = ENDOFCHAIN
+		if err = cf.memory.changeFAT(s); err != nil {
+			return
+		}
+		if next >= 0 {
+			if err = cf.FreeFAT(next, int(OldSize-size)); err != nil {
 				return
 			}
-			if err = s.Read(cf.f, 0, b[offset:]); err != nil {
+		}
+	}
+	this.size = uint64(size)
+	return cf.updateDirectory(this)
+}
+
+// extendChain writes b after the first used bytes of the last sector of the
+// chain, which has the given index, and links new sectors as they are needed.
+func (this *Directory) extendChain(cf *CompoundFile, last *Sector, index, used int, b []byte) (err error) {
+	var n int
+	for len(b) > 0 {
+		if used == last.size {
+			var s *Sector
+			if s, err = cf.addSector(TypeSectorFAT); err != nil {
 				return
 			}
-			offset += s.size
-			SecID = int32(s.next)
+			s.next = ENDOFCHAIN
+			if err = cf.memory.changeFAT(s); err != nil {
+				return
+			}
+			last.next = uint32(s.id)
+			if err = cf.memory.changeFAT(last); err != nil {
+				return
+			}
+			last, used = s, 0
+			index++
+		}
+		if last.data == nil {
+			if err = last.read(cf.r); err != nil {
+				return
+			}
+		}
+		if n, err = last.writeAt(used, b); err != nil {
+			return
+		}
+		used += n
+		b = b[n:]
+	}
+	this.pos = chainPos{index: index, id: int32(last.id), gen: this.chainGen, valid: true}
+	return
+}
+
+// extendMiniChain is extendChain for streams kept in the mini stream.
+func (this *Directory) extendMiniChain(cf *CompoundFile, last *MiniSector, index, used int, b []byte) (err error) {
+	var n int
+	for len(b) > 0 {
+		if used == last.size {
+			var s *MiniSector
+			if s, err = cf.addMiniSector(); err != nil {
+				return
+			}
+			s.next = ENDOFCHAIN
+			if err = cf.memory.changeMiniFAT(s); err != nil {
+				return
+			}
+			last.next = uint32(s.id)
+			if err = cf.memory.changeMiniFAT(last); err != nil {
+				return
+			}
+			last, used = s, 0
+			index++
+		}
+		if last.sector.data == nil {
+			if err = last.sector.read(cf.r); err != nil {
+				return
+			}
+		}
+		if n, err = last.writeAt(used, b); err != nil {
+			return
+		}
+		used += n
+		b = b[n:]
+	}
+	this.pos = chainPos{index: index, id: int32(last.id), gen: this.chainGen, valid: true}
+	return
+}
+
+func (this *Directory) Read(cf *CompoundFile) (b []byte, err error) {
+	if int64(this.size) <= 0 {
+		return
+	}
+	b = make([]byte, this.size)
+	if _, err = this.ReadAt(cf, b, 0, &chainPos{}); err != nil {
+		b = nil
+	}
+	return
+}
+
+// ReadAt reads len(b) bytes of the stream data starting at off. Only the
+// sectors covering the requested range are read. The chain is walked
+// from pos, which is left at the last sector read; a zero chainPos walks
+// it from the start. ReadAt changes nothing else, so calls with their
+// own pos may run at the same time.
+func (this *Directory) ReadAt(cf *CompoundFile, b []byte, off int64, pos *chainPos) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("Negative offset in directory: %v", off)
+	}
+	size := int64(this.size)
+	if off >= size {
+		return 0, io.EOF
+	}
+	want := len(b)
+	if int64(want) > size-off {
+		b = b[:size-off]
+	}
+	if int32(this.startSectorLocation) < 0 {
+		return 0, fmt.Errorf("Start location is error in directory: %v", this.startSectorLocation)
+	}
+
+	mini := this.isMini(cf)
+	sz := int64(cf.SectorSize())
+	if mini {
+		sz = int64(cf.MiniSectorSize())
+	}
+	for n < len(b) {
+		var m int
+		var SecID int32
+		cur := off + int64(n)
+		if SecID, err = this.seekChainFrom(cf, pos, int(cur/sz)); err != nil {
+			return
+		}
+		if mini {
+			var s *MiniSector
+			if s, err = cf.mini.Get(int(SecID)); err != nil {
+				return
+			}
+			m, err = s.readAt(cf.r, int(cur%sz), b[n:])
+		} else {
+			var s *Sector
+			if s, err = cf.sectors.Get(SecID); err != nil {
+				return
+			}
+			m, err = s.readAt(cf.r, int(cur%sz), b[n:])
+		}
+		n += m
+		if err != nil {
+			return
+		}
+	}
+	if n < want {
+		err = io.EOF
+	}
+	return
+}
+
+// isMini reports whether the stream data is kept in the mini stream.
+func (this *Directory) isMini(cf *CompoundFile) bool {
+	return this.objectType == StgStream && this.size < uint64(cf.header.miniStreamCutoffSize)
+}
+
+// seekChain returns the id of the sector at the given index of the
+// stream chain.
+func (this *Directory) seekChain(cf *CompoundFile, index int) (SecID int32, err error) {
+	return this.seekChainFrom(cf, &this.pos, index)
+}
+
+// seekChainFrom is seekChain starting from pos, which it updates.
+func (this *Directory) seekChainFrom(cf *CompoundFile, pos *chainPos, index int) (SecID int32, err error) {
+	mini := this.isMini(cf)
+	i := 0
+	SecID = int32(this.startSectorLocation)
+	if pos.valid && pos.gen == this.chainGen && pos.index <= index {
+		i, SecID = pos.index, pos.id
+	}
+	for ; i < index && SecID >= 0; i++ {
+		if SecID, err = cf.nextSector(SecID, mini); err != nil {
+			return
 		}
 	}
+	if SecID < 0 {
+		err = fmt.Errorf("Sector chain of directory %v ends before sector %v", this.id, index)
+		return
+	}
+	*pos = chainPos{index: index, id: SecID, gen: this.chainGen, valid: true}
 	return
 }
+
+// resetChain forgets the cached chain position. It must be called every
+// time the chain of the stream changes.
+func (this *Directory) resetChain() {
+	this.pos = chainPos{}
+	this.chainGen = chainGens.Add(1)
+}
+
+// chainGens hands out chain generations. They are never reused, so a
+// position taken before Tx.Rollback restored an entry cannot match a
+// chain written after it.
+var chainGens atomic.Int64
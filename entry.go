@@ -0,0 +1,238 @@
+package openmcdf
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// EntryType is the object type of a directory entry.
+type EntryType uint8
+
+const (
+	EntryStream  EntryType = StgStream
+	EntryStorage EntryType = StgStorage
+	EntryRoot    EntryType = StgRoot
+)
+
+func (this EntryType) String() string {
+	switch this {
+	case EntryStream:
+		return "stream"
+	case EntryStorage:
+		return "storage"
+	case EntryRoot:
+		return "root"
+	}
+	return fmt.Sprintf("EntryType(%d)", uint8(this))
+}
+
+// Entry is a stream or storage of a compound file, as listed by a storage.
+type Entry struct {
+	cf *CompoundFile
+	de *Directory
+}
+
+func (this *Directory) newEntry(cf *CompoundFile) Entry {
+	return Entry{cf: cf, de: this}
+}
+
+// Name returns the name of the entry.
+func (this Entry) Name() string {
+	if this.de == nil {
+		return ""
+	}
+	return this.de.Name()
+}
+
+// Type returns whether the entry is a stream, a storage or the root.
+func (this Entry) Type() EntryType {
+	if this.de == nil {
+		return 0
+	}
+	return EntryType(this.de.objectType)
+}
+
+// IsStorage reports whether the entry is a storage or the root storage.
+func (this Entry) IsStorage() bool {
+	t := this.Type()
+	return t == EntryStorage || t == EntryRoot
+}
+
+// Stream returns the stream of a stream entry.
+func (this Entry) Stream() (*Stream, error) {
+	if this.Type() != EntryStream {
+		return nil, fmt.Errorf("This directory isn't stream: %v", this.Name())
+	}
+	return this.de.newStream(this.cf), nil
+}
+
+// Storage returns the storage of a storage or root entry.
+func (this Entry) Storage() (*Storage, error) {
+	switch this.Type() {
+	case EntryStorage:
+		return this.de.newStorage(this.cf), nil
+	case EntryRoot:
+		return this.de.newRootStorage(this.cf), nil
+	}
+	return nil, fmt.Errorf("This directory isn't storage: %v", this.Name())
+}
+
+// The attribute accessors of Storage and Stream forward to the methods
+// below.
+
+func (this Entry) clsid() (clsid [16]byte) {
+	if this.de == nil {
+		return
+	}
+	return this.de.clsid
+}
+
+func (this Entry) stateBits() uint32 {
+	if this.de == nil {
+		return 0
+	}
+	return this.de.stateBits
+}
+
+func (this Entry) created() (t time.Time) {
+	if this.de == nil {
+		return
+	}
+	return this.de.getTimeCreate()
+}
+
+func (this Entry) modified() (t time.Time) {
+	if this.de == nil {
+		return
+	}
+	return this.de.getTimeModification()
+}
+
+func (this Entry) setCLSID(clsid [16]byte) error {
+	return this.update(func(de *Directory) error {
+		de.clsid = clsid
+		return nil
+	})
+}
+
+func (this Entry) setStateBits(bits uint32) error {
+	return this.update(func(de *Directory) error {
+		de.stateBits = bits
+		return nil
+	})
+}
+
+// setTimes sets both times. MS-CFB requires the root storage to have no
+// creation time and streams to have no times at all.
+func (this Entry) setTimes(created, modified time.Time) error {
+	return this.update(func(de *Directory) error {
+		switch de.objectType {
+		case StgRoot:
+			if !created.IsZero() {
+				return ErrRootCreated
+			}
+		case StgStream:
+			if !created.IsZero() || !modified.IsZero() {
+				return ErrStreamTimes
+			}
+		}
+		de.setTimeCreate(created)
+		de.setTimeModification(modified)
+		return nil
+	})
+}
+
+// update changes the directory entry with set and writes it, if the
+// compound file is writable.
+func (this Entry) update(set func(de *Directory) error) (err error) {
+	if this.de == nil {
+		return errors.New("Entry is nil")
+	}
+	if err = this.cf.checkWritable(); err != nil {
+		return
+	}
+	if err = set(this.de); err != nil {
+		return
+	}
+	return this.cf.updateDirectory(this.de)
+}
+
+// Stat returns a snapshot of the entry as an fs.FileInfo. Sys returns
+// an *EntryInfo with the raw directory fields.
+func (this Entry) Stat() fs.FileInfo {
+	info := &fileInfo{}
+	if de := this.de; de != nil {
+		info.name = de.Name()
+		info.sys = EntryInfo{
+			ID:           uint32(de.id),
+			Type:         EntryType(de.objectType),
+			Color:        de.colorFlag,
+			LeftSibling:  de.leftSiblingID,
+			RightSibling: de.rightSiblingID,
+			Child:        de.childID,
+			CLSID:        de.clsid,
+			StateBits:    de.stateBits,
+			Created:      de.getTimeCreate(),
+			Modified:     de.getTimeModification(),
+			StartSector:  de.startSectorLocation,
+			Size:         de.size,
+		}
+	}
+	return info
+}
+
+// EntryInfo holds the raw directory fields of an entry. It is returned
+// by the Sys method of the fs.FileInfo from Stat.
+type EntryInfo struct {
+	ID           uint32
+	Type         EntryType
+	Color        uint8 // Red or Black
+	LeftSibling  uint32
+	RightSibling uint32
+	Child        uint32
+	CLSID        [16]byte
+	StateBits    uint32
+	Created      time.Time
+	Modified     time.Time
+	StartSector  uint32
+	Size         uint64
+}
+
+type fileInfo struct {
+	name string
+	sys  EntryInfo
+}
+
+func (this *fileInfo) Name() string {
+	return this.name
+}
+
+// Size returns the size of a stream; storages have no size.
+func (this *fileInfo) Size() int64 {
+	if this.IsDir() {
+		return 0
+	}
+	return int64(this.sys.Size)
+}
+
+func (this *fileInfo) Mode() fs.FileMode {
+	if this.IsDir() {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// ModTime returns the modification time; it is zero for streams.
+func (this *fileInfo) ModTime() time.Time {
+	return this.sys.Modified
+}
+
+func (this *fileInfo) IsDir() bool {
+	return this.sys.Type == EntryStorage || this.sys.Type == EntryRoot
+}
+
+func (this *fileInfo) Sys() any {
+	return &this.sys
+}
@@ -0,0 +1,255 @@
+package openmcdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FS returns a read-only view of the compound file as a file system:
+// storages are directories and streams are files. Entry names are escaped
+// with EscapeName, so "\x05SummaryInformation" is "%05SummaryInformation".
+// The view implements fs.FS, fs.ReadDirFS, fs.StatFS and fs.ReadFileFS.
+func (this *CompoundFile) FS() *FS {
+	return &FS{cf: this}
+}
+
+// FS is a file system view of a compound file, see CompoundFile.FS.
+type FS struct {
+	cf *CompoundFile
+}
+
+var (
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+)
+
+// Open opens the named stream or storage. A stream is returned as a file
+// that also implements io.Seeker and io.ReaderAt; a storage as an
+// fs.ReadDirFile.
+func (this *FS) Open(name string) (fs.File, error) {
+	e, err := this.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info := this.stat(e, name == ".")
+	if !e.IsStorage() {
+		return &fsFile{stream: e.de.newStream(this.cf), info: info}, nil
+	}
+	entries, err := this.readDir(e)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fsDir{info: info, entries: entries}, nil
+}
+
+// Stat returns the fs.FileInfo of the named stream or storage.
+func (this *FS) Stat(name string) (fs.FileInfo, error) {
+	e, err := this.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return this.stat(e, name == "."), nil
+}
+
+// ReadDir returns the entries of the named storage sorted by name.
+func (this *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := this.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsStorage() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a storage")}
+	}
+	entries, err := this.readDir(e)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// ReadFile returns the data of the named stream.
+func (this *FS) ReadFile(name string) ([]byte, error) {
+	e, err := this.lookup("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	sm, err := e.Stream()
+	if err == nil {
+		var b []byte
+		if b, err = sm.GetData(); err == nil {
+			return b, nil
+		}
+	}
+	return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+}
+
+// lookup finds the entry of an escaped, slash-separated path.
+func (this *FS) lookup(op, name string) (e Entry, err error) {
+	if !fs.ValidPath(name) {
+		return e, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if this.cf == nil || this.cf.root == nil {
+		return e, &fs.PathError{Op: op, Path: name, Err: WrongFormat}
+	}
+	e = this.cf.root.de.newEntry(this.cf)
+	if name == "." {
+		return
+	}
+	for _, elem := range strings.Split(name, "/") {
+		var raw string
+		if raw, err = UnescapeName(elem); err != nil {
+			return e, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		var st *Storage
+		var de *Directory
+		if st, err = e.Storage(); err == nil {
+			de, err = st.getDirectory(raw)
+		}
+		if err != nil || de == nil {
+			return e, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		e = de.newEntry(this.cf)
+	}
+	return
+}
+
+// stat returns the FileInfo of an entry under its escaped name, or "."
+// for the root of the view.
+func (this *FS) stat(e Entry, root bool) fs.FileInfo {
+	info := e.Stat().(*fileInfo)
+	if root {
+		info.name = "."
+	} else {
+		info.name = EscapeName(info.name)
+	}
+	return info
+}
+
+func (this *FS) readDir(e Entry) ([]fs.DirEntry, error) {
+	st, err := e.Storage()
+	if err != nil {
+		return nil, err
+	}
+	if err = st.loadChildren(); err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, 0, st.tree.Size())
+	for _, child := range st.entries() {
+		entries = append(entries, fs.FileInfoToDirEntry(this.stat(child, false)))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+// fsFile is an open stream of an FS. Only the reading methods of the
+// stream are exposed.
+type fsFile struct {
+	stream *Stream
+	info   fs.FileInfo
+}
+
+func (this *fsFile) Read(p []byte) (int, error) {
+	return this.stream.Read(p)
+}
+
+func (this *fsFile) ReadAt(p []byte, off int64) (int, error) {
+	return this.stream.ReadAt(p, off)
+}
+
+func (this *fsFile) Seek(offset int64, whence int) (int64, error) {
+	return this.stream.Seek(offset, whence)
+}
+
+func (this *fsFile) Stat() (fs.FileInfo, error) {
+	return this.info, nil
+}
+
+func (this *fsFile) Close() error {
+	return nil
+}
+
+// fsDir is an open storage of an FS.
+type fsDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (this *fsDir) Stat() (fs.FileInfo, error) {
+	return this.info, nil
+}
+
+func (this *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: this.info.Name(), Err: errors.New("is a storage")}
+}
+
+func (this *fsDir) Close() error {
+	return nil
+}
+
+func (this *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := this.entries[this.offset:]
+	if n <= 0 {
+		this.offset = len(this.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	this.offset += n
+	return rest[:n], nil
+}
+
+// EscapeName turns an entry name into a valid path element for FS:
+// control characters, '/' and '%' become %XX, and the names "." and ".."
+// have their dots escaped.
+func EscapeName(name string) string {
+	if name == "." || name == ".." {
+		return strings.Repeat("%2E", len(name))
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 0x20 || c == 0x7F || c == '/' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// UnescapeName reverses EscapeName.
+func UnescapeName(s string) (string, error) {
+	if strings.IndexByte(s, '%') < 0 {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("Invalid escape in name: %q", s)
+		}
+		c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("Invalid escape in name: %q", s)
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -2,7 +2,6 @@ package openmcdf
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -14,7 +13,7 @@ const (
 	FREESECT   = uint32(0xFFFFFFFF) //-1
 	ENDOFCHAIN = uint32(0xFFFFFFFE) //-2
 	FATSECT    = uint32(0xFFFFFFFD) //-3
-	DIFSECT    = uint32(0xFFFFFFC)  //-4
+	DIFSECT    = uint32(0xFFFFFFFC) //-4
 )
 
 var (
@@ -123,7 +122,7 @@ func (this *Header) getVersion() int {
 }
 
 func (this *Header) Read(r io.Reader) (err error) {
-	defer RecoverError(err)
+	defer RecoverError(&err)
 
 	//Read
 	check(ReadData(r, this.signature[:]))                  //8 byte
@@ -208,12 +207,32 @@ func (this *Header) checkUserDefinedFieldSize() error {
 	return nil
 }
 
-func (this *Header) Bytes() ([]byte, error) {
-	buf := bytes.NewBuffer(nil)
-	if err := binary.Write(buf, binary.LittleEndian, this); err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
+func (this *Header) Bytes() (b []byte, err error) {
+	defer RecoverError(&err)
+
+	buf := bytes.NewBuffer(make([]byte, 0, HeaderSize))
+	check(WriteData(buf, this.signature[:]))
+	check(WriteData(buf, this.unused_clsid[:]))
+	check(WriteData(buf, this.minorVersion))
+	check(WriteData(buf, this.majorVersion))
+	check(WriteData(buf, this.byteOrder))
+	check(WriteData(buf, this.sectorShift))
+	check(WriteData(buf, this.miniSectorShift))
+	check(WriteData(buf, this.reserved[:]))
+	check(WriteData(buf, this.numDirectorySector))
+	check(WriteData(buf, this.numFATSector))
+	check(WriteData(buf, this.firstDirectorySectorLocation))
+	check(WriteData(buf, this.transactionSignatureNumber))
+	check(WriteData(buf, this.miniStreamCutoffSize))
+	check(WriteData(buf, this.firstMiniFATSectorLocation))
+	check(WriteData(buf, this.numMiniFATSector))
+	check(WriteData(buf, this.firstDIFATSectorLocation))
+	check(WriteData(buf, this.numDIFATSector))
+	check(WriteData(buf, this.headerDIFAT[:]))
+	//512 byte
+
+	b = buf.Bytes()
+	return
 }
 
 func (this *Header) sectorSize() int {
@@ -0,0 +1,320 @@
+package openmcdf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// JournalSuffix is appended to the file name to name the journal of a
+// durable commit, see OpenOptions.Durable.
+const JournalSuffix = "-journal"
+
+var journalMagic = [8]byte{'M', 'C', 'D', 'F', 'J', 'R', 'N', 'L'}
+
+var (
+	ErrJournalTorn = errors.New("the journal is incomplete")
+	ErrNotJournal  = errors.New("the journal file does not start with the journal magic")
+)
+
+// SyncWriter is a file written by a durable commit. *os.File implements it.
+type SyncWriter interface {
+	io.WriterAt
+	Truncate(size int64) error
+	Sync() error
+}
+
+// journalRecord is a block of the file to be written at offset.
+type journalRecord struct {
+	offset int64
+	data   []byte
+}
+
+// journal holds everything a commit writes: the modified sectors, the
+// header and the final size of the file.
+type journal struct {
+	size    int64
+	records []journalRecord
+}
+
+// writeTo encodes the journal into w: a magic, the file size, the record
+// count, every record as offset, length and data, and a CRC-32 of all of
+// it. The records are written one after the other through a buffer, so
+// the sectors of a large commit are not copied into memory again.
+func (this *journal) writeTo(w io.Writer) (err error) {
+	bw := bufio.NewWriter(w)
+	crc := crc32.NewIEEE()
+	mw := io.MultiWriter(bw, crc)
+	if _, err = mw.Write(journalMagic[:]); err != nil {
+		return
+	}
+	if err = binary.Write(mw, binary.LittleEndian, this.size); err != nil {
+		return
+	}
+	if err = binary.Write(mw, binary.LittleEndian, uint32(len(this.records))); err != nil {
+		return
+	}
+	for _, rec := range this.records {
+		if err = binary.Write(mw, binary.LittleEndian, rec.offset); err != nil {
+			return
+		}
+		if err = binary.Write(mw, binary.LittleEndian, uint32(len(rec.data))); err != nil {
+			return
+		}
+		if _, err = mw.Write(rec.data); err != nil {
+			return
+		}
+	}
+	if err = binary.Write(bw, binary.LittleEndian, crc.Sum32()); err != nil {
+		return
+	}
+	return bw.Flush()
+}
+
+// readJournal decodes a journal. A journal that is shorter than the
+// magic, or starts with it but is short or fails the checksum, was not
+// completely written and gives ErrJournalTorn. Any other content is not
+// a journal and gives ErrNotJournal.
+func readJournal(b []byte) (*journal, error) {
+	if len(b) < len(journalMagic) {
+		return nil, ErrJournalTorn
+	}
+	if !bytes.Equal(b[:len(journalMagic)], journalMagic[:]) {
+		return nil, ErrNotJournal
+	}
+	if len(b) < len(journalMagic)+8+4+4 {
+		return nil, ErrJournalTorn
+	}
+	body := b[:len(b)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(b[len(b)-4:]) {
+		return nil, ErrJournalTorn
+	}
+	r := bytes.NewReader(body[len(journalMagic):])
+	j := &journal{}
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &j.size); err != nil {
+		return nil, ErrJournalTorn
+	}
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, ErrJournalTorn
+	}
+	for i := uint32(0); i < count; i++ {
+		var rec journalRecord
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &rec.offset); err != nil {
+			return nil, ErrJournalTorn
+		}
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, ErrJournalTorn
+		}
+		if int64(n) > int64(r.Len()) {
+			return nil, ErrJournalTorn
+		}
+		rec.data = make([]byte, n)
+		if _, err := io.ReadFull(r, rec.data); err != nil {
+			return nil, ErrJournalTorn
+		}
+		j.records = append(j.records, rec)
+	}
+	if r.Len() != 0 {
+		return nil, ErrJournalTorn
+	}
+	return j, nil
+}
+
+// apply writes the records, resizes the file and syncs it. Applying a
+// journal twice gives the same file, so recovery can be repeated.
+func (this *journal) apply(w SyncWriter) error {
+	for _, rec := range this.records {
+		if _, err := w.WriteAt(rec.data, rec.offset); err != nil {
+			return err
+		}
+	}
+	if err := w.Truncate(this.size); err != nil {
+		return err
+	}
+	return w.Sync()
+}
+
+// journal collects the writes of the next commit.
+func (this *CompoundFile) journal() (j *journal, err error) {
+	j = &journal{size: int64(this.sectors.Len()+1) * int64(this.SectorSize())}
+	it := this.sectors.Iterator()
+	for it.Next() {
+		s := it.Value()
+		if s.modified && s.data != nil {
+			j.records = append(j.records, journalRecord{offset: s.offset(), data: s.data})
+		}
+	}
+	var b []byte
+	if b, err = this.headerSector(); err != nil {
+		return nil, err
+	}
+	//The header goes last, as in Commit
+	j.records = append(j.records, journalRecord{offset: 0, data: b})
+	return
+}
+
+// commitDurable writes the changes to the journal first and syncs it, then
+// to the file. A crash before the journal is complete leaves the file as
+// it was; a crash after it is recovered by OpenFile.
+func (this *CompoundFile) commitDurable() (err error) {
+	var j *journal
+	if j, err = this.journal(); err != nil {
+		return
+	}
+	name := this.name + JournalSuffix
+	if err = this.writeJournal(name, j); err != nil {
+		return
+	}
+	if err = syncDir(filepath.Dir(name)); err != nil {
+		return
+	}
+	if err = j.apply(this.writer(this.name, this.f)); err != nil {
+		return
+	}
+	if err = os.Remove(name); err != nil {
+		return
+	}
+	this.markCommitted()
+	return syncDir(filepath.Dir(name))
+}
+
+// writeJournal creates the named file with the journal as its content
+// and syncs it.
+func (this *CompoundFile) writeJournal(name string, j *journal) (err error) {
+	var f *os.File
+	if f, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		return
+	}
+	w := this.writer(name, f)
+	if err = j.writeTo(io.NewOffsetWriter(w, 0)); err == nil {
+		err = w.Sync()
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	return
+}
+
+func (this *CompoundFile) writer(name string, f *os.File) SyncWriter {
+	if this.wrap != nil {
+		return this.wrap(name, f)
+	}
+	return f
+}
+
+// loadJournal reads the journal left next to filename by a crashed
+// durable commit. found tells whether there is a journal file; j is nil
+// when there is none or it was not completely written. A file that is
+// not a journal gives ErrNotJournal.
+func loadJournal(filename string) (j *journal, found bool, err error) {
+	var b []byte
+	if b, err = os.ReadFile(filename + JournalSuffix); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	found = true
+	if j, err = readJournal(b); err == ErrJournalTorn {
+		j, err = nil, nil
+	} else if err != nil {
+		err = fmt.Errorf("%w: %s", err, filename+JournalSuffix)
+	}
+	return
+}
+
+// recoverJournal finishes a durable commit interrupted by a crash. A
+// complete journal is applied to the file; an incomplete one means the
+// file was not touched yet and is removed. A file that is not a journal
+// is left alone.
+func recoverJournal(filename string, wrap func(string, SyncWriter) SyncWriter) (err error) {
+	var j *journal
+	var found bool
+	if j, found, err = loadJournal(filename); err != nil || !found {
+		return
+	}
+	if j != nil {
+		var f *os.File
+		if f, err = os.OpenFile(filename, os.O_RDWR, 0); err != nil {
+			return
+		}
+		var w SyncWriter = f
+		if wrap != nil {
+			w = wrap(filename, f)
+		}
+		err = j.apply(w)
+		if errClose := f.Close(); err == nil {
+			err = errClose
+		}
+		if err != nil {
+			return
+		}
+	}
+	name := filename + JournalSuffix
+	if err = os.Remove(name); err != nil {
+		return
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// journalReader reads a file as applying a complete journal would leave
+// it, without writing to the file. A read-only open uses it.
+type journalReader struct {
+	r io.ReaderAt
+	j *journal
+}
+
+func (this *journalReader) ReadAt(b []byte, off int64) (n int, err error) {
+	if off >= this.j.size {
+		return 0, io.EOF
+	}
+	if rest := this.j.size - off; int64(len(b)) > rest {
+		b, err = b[:rest], io.EOF
+	}
+	m, errRead := this.r.ReadAt(b, off)
+	if errRead != nil && errRead != io.EOF {
+		return m, errRead
+	}
+	//The journal may grow the file, which reads as zeros
+	for i := m; i < len(b); i++ {
+		b[i] = 0
+	}
+	for _, rec := range this.j.records {
+		end := rec.offset + int64(len(rec.data))
+		if end <= off || rec.offset >= off+int64(len(b)) {
+			continue
+		}
+		if rec.offset >= off {
+			copy(b[rec.offset-off:], rec.data)
+		} else {
+			copy(b, rec.data[off-rec.offset:])
+		}
+	}
+	return len(b), err
+}
+
+// syncDir makes a created, renamed or removed file in dir durable.
+func syncDir(dir string) (err error) {
+	if runtime.GOOS == "windows" {
+		//Windows cannot sync a directory; its metadata is journaled
+		return nil
+	}
+	var d *os.File
+	if d, err = os.Open(dir); err != nil {
+		return
+	}
+	err = d.Sync()
+	if errClose := d.Close(); err == nil {
+		err = errClose
+	}
+	return
+}
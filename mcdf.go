@@ -1,8 +1,10 @@
 package openmcdf
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 )
 
@@ -10,10 +12,40 @@ const UInt32Size = 4
 
 var (
 	WrongFormat = errors.New("Wrong file format")
+	ErrReadOnly = errors.New("The compound file is opened read-only")
 )
 
+// OpenOptions controls how an existing compound file is opened.
+type OpenOptions struct {
+	// ReadOnly opens the file without write access. Every call that
+	// would modify the file returns ErrReadOnly.
+	ReadOnly bool
+	// ValidateTrees checks the sibling tree of every storage on opening:
+	// ids must be in range, every entry reached once and siblings sorted
+	// by the MS-CFB name comparison. A malformed tree fails with
+	// ErrInvalidTree.
+	ValidateTrees bool
+	// RebalanceTrees rewrites the sibling tree of every storage as a
+	// balanced red-black tree in MS-CFB order. The next Commit or Save
+	// writes the new trees. It needs write access.
+	RebalanceTrees bool
+	// Durable makes Commit crash-safe. The changes are written to a
+	// journal next to the file, named with JournalSuffix, and synced
+	// before the file itself is written. OpenFile finishes or discards a
+	// journal left by a crash, also without Durable. A read-only open
+	// leaves the file and the journal alone and reads the file as a
+	// complete journal would leave it. Durable and WrapWriter only apply
+	// to OpenFile; OpenReader and OpenBytes reject them.
+	Durable bool
+	// WrapWriter, if set, wraps every file a durable Commit or the
+	// recovery of a journal writes to: the compound file and its journal.
+	// It lets tests fail the writes from a given step on.
+	WrapWriter func(name string, w SyncWriter) SyncWriter
+}
+
 type CompoundFile struct {
 	f      *os.File
+	r      io.ReaderAt
 	header *Header
 	//memmory
 	memory *Memory
@@ -26,6 +58,14 @@ type CompoundFile struct {
 	//other
 	miniSectorSize int
 	sectorSize     int
+	readOnly       bool
+	tx             *Tx
+	//bumped on every change of a sibling tree
+	generation int
+	//durable commit
+	name    string
+	durable bool
+	wrap    func(string, SyncWriter) SyncWriter
 }
 
 func New(ver int) (this *CompoundFile, err error) {
@@ -57,39 +97,165 @@ func New(ver int) (this *CompoundFile, err error) {
 	return
 }
 
-func Open(filename string) (this *CompoundFile, err error) {
+// Create creates the named compound file, truncating it if it already
+// exists. The compound file stays bound to the file, so every Commit
+// writes the work done so far and committed stream data does not have to
+// stay in memory.
+func Create(filename string, ver int) (this *CompoundFile, err error) {
+	if this, err = New(ver); err != nil {
+		return
+	}
+	var f *os.File
+	if f, err = os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		this.Close()
+		this = nil
+		return
+	}
+	this.f = f
+	this.r = f
+	if err = this.Commit(); err != nil {
+		this.Close()
+		this = nil
+	}
+	return
+}
+
+func Open(filename string) (*CompoundFile, error) {
+	return OpenFile(filename, OpenOptions{})
+}
+
+// OpenFile opens the named compound file with the given options.
+func OpenFile(filename string, opts OpenOptions) (this *CompoundFile, err error) {
+	var j *journal
+	if opts.ReadOnly {
+		j, _, err = loadJournal(filename)
+	} else {
+		err = recoverJournal(filename, opts.WrapWriter)
+	}
+	if err != nil {
+		return
+	}
 	var fileInfo os.FileInfo
 	fileInfo, err = os.Stat(filename)
 	if err != nil {
 		return
-	} else {
-		if fileInfo.Size() < 512 {
-			err = WrongFormat
+	}
+	size := fileInfo.Size()
+	if j != nil {
+		size = j.size
+	}
+	if size < HeaderSize {
+		err = WrongFormat
+		return
+	}
+	flag := os.O_RDWR
+	if opts.ReadOnly {
+		flag = os.O_RDONLY
+	}
+	var f *os.File
+	if f, err = os.OpenFile(filename, flag, 0644); err != nil {
+		return
+	}
+	this = &CompoundFile{
+		f:        f,
+		r:        f,
+		readOnly: opts.ReadOnly,
+		name:     filename,
+		durable:  opts.Durable,
+		wrap:     opts.WrapWriter,
+	}
+	if j != nil {
+		this.r = &journalReader{r: f, j: j}
+	}
+	if err = this.open(size, opts); err != nil {
+		this.Close()
+		this = nil
+	}
+	return
+}
+
+// OpenReader reads a compound file from r, which holds size bytes.
+// The reader must stay valid until the compound file is closed. Durable
+// and WrapWriter need a file on disk and are rejected; use OpenFile.
+func OpenReader(r io.ReaderAt, size int64, opts ...OpenOptions) (this *CompoundFile, err error) {
+	if r == nil {
+		err = errors.New("Reader is nil")
+		return
+	} else if size < HeaderSize {
+		err = WrongFormat
+		return
+	}
+	var opt OpenOptions
+	for _, o := range opts {
+		if o.Durable || o.WrapWriter != nil {
+			err = errors.New("Durable and WrapWriter only apply to OpenFile")
 			return
 		}
-		var f *os.File
-		if f, err = os.OpenFile(filename, os.O_RDWR, 0644); err != nil {
+		opt.ReadOnly = opt.ReadOnly || o.ReadOnly
+		opt.ValidateTrees = opt.ValidateTrees || o.ValidateTrees
+		opt.RebalanceTrees = opt.RebalanceTrees || o.RebalanceTrees
+	}
+	this = &CompoundFile{
+		r: r,
+	}
+	this.readOnly = opt.ReadOnly
+	err = this.open(size, opt)
+	return
+}
+
+// OpenBytes reads a compound file from an in-memory image.
+func OpenBytes(b []byte, opts ...OpenOptions) (*CompoundFile, error) {
+	return OpenReader(bytes.NewReader(b), int64(len(b)), opts...)
+}
+
+func (this *CompoundFile) open(size int64, opts OpenOptions) (err error) {
+	this.header = &Header{}
+	if err = this.header.Read(io.NewSectionReader(this.r, 0, HeaderSize)); err != nil {
+		return
+	}
+	this.sectorSize = this.header.sectorSize()
+	this.miniSectorSize = this.header.miniSectorSize()
+
+	this.memory = newMemory(this.sectorSize)
+	this.mini = newMiniMemory(this.miniSectorSize)
+
+	if size < int64(this.SectorSize()) {
+		return WrongFormat
+	}
+	//The header takes up the whole first sector
+	n := int((size - int64(this.SectorSize())) / int64(this.SectorSize()))
+	this.sectors = newSectorCollection(this.SectorSize(), n)
+
+	if err = this.load(); err != nil {
+		return
+	}
+	if opts.ValidateTrees {
+		if err = this.checkTrees(true); err != nil {
 			return
 		}
-		this = &CompoundFile{
-			header: &Header{},
-			f:      f,
+	}
+	if opts.RebalanceTrees {
+		if err = this.checkWritable(); err != nil {
+			return
 		}
-		if err = this.header.Read(f); err != nil {
+		if err = this.checkTrees(false); err != nil {
 			return
 		}
-		this.sectorSize = this.header.sectorSize()
-		this.miniSectorSize = this.header.miniSectorSize()
+		err = this.root.rebalance()
+	}
+	return
+}
 
-		this.memory = newMemory(this.sectorSize)
-		this.mini = newMiniMemory(this.miniSectorSize)
+// ReadOnly reports whether the compound file was opened read-only.
+func (this *CompoundFile) ReadOnly() bool {
+	return this != nil && this.readOnly
+}
 
-		n := int((fileInfo.Size() - HeaderSize) / int64(this.SectorSize()))
-		size := this.SectorSize()
-		this.sectors = newSectorCollection(size, n)
+func (this *CompoundFile) checkWritable() error {
+	if this.readOnly {
+		return ErrReadOnly
 	}
-	err = this.load()
-	return
+	return nil
 }
 
 func (this *CompoundFile) Header() *Header {
@@ -142,7 +308,7 @@ func (this *CompoundFile) readFAT() (err error) {
 		if s, err = this.sectors.Get(int32(this.header.headerDIFAT[i])); err != nil {
 			return
 		}
-		if err = s.read(this.f); err != nil {
+		if err = s.read(this.r); err != nil {
 			return
 		}
 		if err = this.memory.addSector(s, MemoryTableFat); err != nil {
@@ -160,7 +326,7 @@ func (this *CompoundFile) readFAT() (err error) {
 			if s, err = this.sectors.Get(offset); err != nil {
 				return
 			}
-			err = s.Read(this.f, 0, buf)
+			err = s.Read(this.r, 0, buf)
 			if err != nil {
 				err = fmt.Errorf("Error read DIFAT sector %v: %v", s.id, err)
 				return
@@ -177,7 +343,7 @@ func (this *CompoundFile) readFAT() (err error) {
 				if s, err = this.sectors.Get(SecID); err != nil {
 					return
 				}
-				if err = s.read(this.f); err != nil {
+				if err = s.read(this.r); err != nil {
 					return
 				}
 				if err = this.memory.addSector(s, MemoryTableFat); err != nil {
@@ -229,7 +395,7 @@ func (this *CompoundFile) readDirectory() (err error) {
 			cycles[s] = true
 		}
 
-		err := s.Read(this.f, 0, buf)
+		err := s.Read(this.r, 0, buf)
 		if err != nil {
 			return fmt.Errorf("Directory entries read error: %v", err)
 		}
@@ -275,7 +441,7 @@ func (this *CompoundFile) readMiniFAT() (err error) {
 			err = fmt.Errorf("Get MiniFAT error: %v", err)
 			return
 		}
-		if err = s.read(this.f); err != nil {
+		if err = s.read(this.r); err != nil {
 			err = fmt.Errorf("MiniFAT read error: %v", err)
 			return
 		}
@@ -347,7 +513,9 @@ func (this *CompoundFile) Close() {
 	this.header = nil
 	if this.f != nil {
 		_ = this.f.Close()
+		this.f = nil
 	}
+	this.r = nil
 
 	//memory
 	if this.memory != nil {
@@ -456,6 +624,11 @@ func (this *CompoundFile) addSector(Type SectorType) (*Sector, error) {
 			this.header.firstDirectorySectorLocation = uint32(fst.id)
 			this.header.modified = true
 		}
+		//Version 3 files must leave the number of directory sectors at zero
+		if this.header.getVersion() == 4 {
+			this.header.numDirectorySector = uint32(this.memory.Len(MemoryDir))
+			this.header.modified = true
+		}
 		return s, nil
 	case TypeSectorFAT:
 		var s *Sector
@@ -465,6 +638,9 @@ func (this *CompoundFile) addSector(Type SectorType) (*Sector, error) {
 			if s, err = this.memory.Pop(); err != nil {
 				return nil, err
 			}
+			//A reused sector starts empty
+			s.data = make([]byte, s.size)
+			s.modified = true
 			return s, nil
 		}
 		if this.sectors.Len() >= this.memory.CountUint32(MemoryTableFat) {
@@ -502,12 +678,13 @@ func (this *CompoundFile) addSector(Type SectorType) (*Sector, error) {
 
 		//Add in header or DIFFAT
 		size := this.memory.Len(MemoryTableFat)
+		this.header.numFATSector = uint32(size)
+		this.header.modified = true
 		if size <= len(this.header.headerDIFAT) &&
 			this.header.numDIFATSector == 0 {
 			//size <= 109
 
-			this.header.numFATSector = uint32(size)
-			this.header.headerDIFAT[this.header.numFATSector-1] = uint32(s.id)
+			this.header.headerDIFAT[size-1] = uint32(s.id)
 		} else {
 			//size >= 110
 			var difat *Sector
@@ -612,6 +789,15 @@ func (this *CompoundFile) addSector(Type SectorType) (*Sector, error) {
 				return nil, err
 			}
 		}
+		//The size of the root entry is the size of the mini stream
+		root, err := this.directory.Get(0)
+		if err != nil {
+			return nil, err
+		}
+		root.size = uint64(this.mini.Len() * this.MiniSectorSize())
+		if err = this.updateDirectory(root); err != nil {
+			return nil, err
+		}
 		return s, nil
 	case TypeSectorMemmoryMiniFAT:
 		s, err := this.addSector(TypeSectorFAT)
@@ -650,71 +836,171 @@ func (this *CompoundFile) addSector(Type SectorType) (*Sector, error) {
 	return nil, fmt.Errorf("unknown type sector: %v", Type)
 }
 
-func (this *CompoundFile) Save(filename string) error {
-	if this == nil {
+// Save writes the compound file to the named file. The image goes to a
+// temporary file in the same directory that is synced and renamed over
+// the target, so a crash or a full disk never leaves a truncated file;
+// see SaveOptions for the permission and how far Save syncs. Saving over
+// the file the compound file was opened from replaces it the same way,
+// and the compound file is bound to the new file afterwards; a read-only
+// compound file returns ErrReadOnly instead.
+func (this *CompoundFile) Save(filename string, opts ...SaveOptions) (err error) {
+	if this == nil || this.header == nil {
 		return fmt.Errorf("The file is not saved: %v", filename)
 	}
+	var opt SaveOptions
+	for _, o := range opts {
+		opt = o
+	}
+	same := false
+	if this.f != nil {
+		if fi, err := os.Stat(filename); err == nil {
+			if src, err := this.f.Stat(); err == nil && os.SameFile(fi, src) {
+				same = true
+			}
+		}
+	}
+	if same && this.readOnly {
+		return ErrReadOnly
+	}
+	if same && this.tx != nil {
+		return ErrTxActive
+	}
 
-	b, err := this.header.Bytes()
-	if err != nil {
-		return err
+	var rename func(tmp, filename string) error
+	if same {
+		rename = this.replaceSource
 	}
-	f := NewFile()
-	defer f.Close()
+	return writeAtomic(filename, opt, func(w io.Writer) (err error) {
+		_, err = this.WriteTo(w)
+		return
+	}, rename)
+}
 
-	if err = f.WriteAt(b, 0); err != nil {
-		return err
+// headerSector returns the header padded with zeros to a whole sector.
+func (this *CompoundFile) headerSector() (b []byte, err error) {
+	if b, err = this.header.Bytes(); err != nil {
+		return
+	}
+	b = append(b, make([]byte, this.SectorSize()-len(b))...)
+	return
+}
+
+// WriteTo writes the header and then every sector in order to w. Sectors
+// that are not loaded are copied from the source one at a time, so the
+// image is never held in memory as a whole.
+func (this *CompoundFile) WriteTo(w io.Writer) (n int64, err error) {
+	if this == nil || this.header == nil {
+		return 0, errors.New("The compound file is closed")
 	}
+	var m int
+	var b []byte
+	if b, err = this.headerSector(); err != nil {
+		return
+	}
+	m, err = w.Write(b)
+	n += int64(m)
+	if err != nil {
+		return
+	}
+
 	it := this.sectors.Iterator()
-	offset := HeaderSize
-	b = make([]byte, this.SectorSize())
 	for it.Next() {
-		if err = it.Value().Read(this.f, 0, b); err != nil {
-			return err
+		if err = this.sectorData(it.Value(), b); err != nil {
+			return
 		}
-		if err = f.WriteAt(b, offset); err != nil {
-			return err
+		m, err = w.Write(b)
+		n += int64(m)
+		if err != nil {
+			return
 		}
-		offset += this.SectorSize()
 	}
-	return f.Save(filename, 0644)
+	return
 }
 
+// sectorData copies the current content of the sector into b without
+// loading it into memory. Free sectors that are not loaded are zeros.
+func (this *CompoundFile) sectorData(s *Sector, b []byte) (err error) {
+	if s.data == nil && s.next == FREESECT {
+		for i := range b {
+			b[i] = 0
+		}
+		return
+	}
+	_, err = s.readAt(this.r, 0, b)
+	return
+}
+
+// Commit writes the changes to the file the compound file is bound to.
+// Every modified sector goes to its own offset, the file is resized to
+// the sector count, and the header is written last before the file is
+// synced to stable storage. A file opened with OpenOptions.Durable goes
+// through a journal first, see commitDurable.
 func (this *CompoundFile) Commit() error {
 	if this == nil || this.f == nil {
 		return fmt.Errorf("The file is not saved")
 	}
+	if err := this.checkWritable(); err != nil {
+		return err
+	}
+	if this.tx != nil {
+		return ErrTxActive
+	}
+	if this.durable {
+		return this.commitDurable()
+	}
 
-	if this.header.modified {
-		b, err := this.header.Bytes()
-		if err != nil {
+	it := this.sectors.Iterator()
+	for it.Next() {
+		s := it.Value()
+		if !s.modified || s.data == nil {
+			continue
+		}
+		if _, err := this.f.WriteAt(s.data, s.offset()); err != nil {
 			return err
 		}
-		if _, err = this.f.WriteAt(b, 0); err != nil {
+	}
+
+	size := int64(this.sectors.Len()+1) * int64(this.SectorSize())
+	fi, err := this.f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() != size {
+		if err = this.f.Truncate(size); err != nil {
 			return err
 		}
-		this.header.modified = false
 	}
 
+	b, err := this.headerSector()
+	if err != nil {
+		return err
+	}
+	if _, err = this.f.WriteAt(b, 0); err != nil {
+		return err
+	}
+	if err = this.f.Sync(); err != nil {
+		return err
+	}
+	this.markCommitted()
+	return nil
+}
+
+// markCommitted clears the modified flags once the file holds every
+// sector.
+func (this *CompoundFile) markCommitted() {
 	it := this.sectors.Iterator()
-	offset := int64(HeaderSize)
-	b := make([]byte, this.SectorSize())
 	for it.Next() {
 		s := it.Value()
-		if !s.modified {
+		if !s.modified || s.data == nil {
 			continue
 		}
-		err := s.Read(this.f, 0, b)
-		if err != nil {
-			return err
-		}
-		if _, err = this.f.WriteAt(b, offset); err != nil {
-			return err
-		}
 		s.modified = false
-		offset += int64(this.SectorSize())
+		//Stream data can be read back from the file
+		if s.sectorType == TypeSectorFAT || s.sectorType == TypeSectorMiniFAT {
+			s.data = nil
+		}
 	}
-	return nil
+	this.header.modified = false
 }
 
 func (this *CompoundFile) FreeFAT(SecID int32, size int) (err error) {
@@ -729,6 +1015,7 @@ func (this *CompoundFile) FreeFAT(SecID int32, size int) (err error) {
 			return
 		}
 		SecID = int32(s.next)
+		offset += s.size
 		if s.data == nil {
 			s.data = make([]byte, s.size)
 			s.modified = true
@@ -756,6 +1043,7 @@ func (this *CompoundFile) FreeMiniFAT(SecID int32, size int) (err error) {
 			return
 		}
 		SecID = int32(s.next)
+		offset += s.size
 		if err = this.mini.Push(s); err != nil {
 			return
 		}
@@ -766,12 +1054,28 @@ func (this *CompoundFile) FreeMiniFAT(SecID int32, size int) (err error) {
 	return
 }
 
+// nextSector returns the id following SecID in the FAT or mini FAT chain.
+func (this *CompoundFile) nextSector(SecID int32, mini bool) (int32, error) {
+	if mini {
+		s, err := this.mini.Get(int(SecID))
+		if err != nil {
+			return -1, err
+		}
+		return int32(s.next), nil
+	}
+	s, err := this.sectors.Get(SecID)
+	if err != nil {
+		return -1, err
+	}
+	return int32(s.next), nil
+}
+
 func (this *CompoundFile) SectorBytes(SecID int32) (b []byte, err error) {
 	var s *Sector
 	if s, err = this.sectors.Get(SecID); err != nil {
 		return
 	}
 	b = make([]byte, s.size)
-	err = s.Read(this.f, 0, b)
+	err = s.Read(this.r, 0, b)
 	return
 }
@@ -53,27 +53,27 @@ func (this *Memory) addSector(s *Sector, t TypeMemory) error {
 	switch t {
 	case MemoryTableFat:
 		s.sectorType = TypeSectorMemmoryFAT
-		if s.next == 0 {
+		if s.next == 0 || s.next == FREESECT {
 			s.next = FATSECT
 		}
 	case MemoryTableMini:
 		s.sectorType = TypeSectorMemmoryMiniFAT
-		if s.next == 0 {
+		if s.next == 0 || s.next == FREESECT {
 			s.next = ENDOFCHAIN
 		}
 	case MemoryDir:
 		s.sectorType = TypeSectorMemmoryDirectory
-		if s.next == 0 {
+		if s.next == 0 || s.next == FREESECT {
 			s.next = ENDOFCHAIN
 		}
 	case MemoryDIFAT:
 		s.sectorType = TypeSectorMemmoryDIFAT
-		if s.next == 0 {
+		if s.next == 0 || s.next == FREESECT {
 			s.next = DIFSECT
 		}
 	case MemoryFree:
 		s.sectorType = TypeSectorFAT
-		if s.next == 0 {
+		if s.next == 0 || s.next == FREESECT {
 			s.next = FREESECT
 		}
 	default:
@@ -237,6 +237,7 @@ func (this *Memory) Pop() (*Sector, error) {
 }
 
 func (this *Memory) Push(s *Sector) (err error) {
+	s.next = FREESECT
 	err = this.addSector(s, MemoryFree)
 	if s.data != nil {
 		s.data = nil
@@ -2,11 +2,13 @@ package openmcdf
 
 import (
 	"fmt"
+	"sort"
 )
 
 type MiniMemory struct {
-	data       []*MiniSector
-	free       map[*MiniSector]bool
+	data []*MiniSector
+	//free mini sectors sorted by id
+	free       []*MiniSector
 	sectorSize int
 }
 
@@ -18,7 +20,6 @@ type MiniMemoryIterator struct {
 
 func newMiniMemory(sectorSize int) *MiniMemory {
 	this := &MiniMemory{
-		free:       make(map[*MiniSector]bool),
 		sectorSize: sectorSize,
 		data:       make([]*MiniSector, 0, 10),
 	}
@@ -54,7 +55,9 @@ func (this *MiniMemory) Delete(s *MiniSector) (err error) {
 		return
 	}
 	//delete element
-	delete(this.free, s)
+	if i, ok := this.findFree(s); ok {
+		this.free = append(this.free[:i], this.free[i+1:]...)
+	}
 	this.data = append(this.data[:s.id], this.data[s.id+1:]...)
 	return
 }
@@ -63,8 +66,8 @@ func (this *MiniMemory) Close() {
 	for i := range this.data {
 		this.data[i] = nil
 	}
-	for s := range this.free {
-		delete(this.free, s)
+	for i := range this.free {
+		this.free[i] = nil
 	}
 	this.data = nil
 	this.free = nil
@@ -111,24 +114,39 @@ func (this *MiniMemory) Get(id int) (*MiniSector, error) {
 	return this.data[id], nil
 }
 
+// Pop takes the free mini sector with the lowest id, so that a stream
+// written in one go gets consecutive mini sectors.
 func (this *MiniMemory) Pop() *MiniSector {
-	for s := range this.free {
-		delete(this.free, s)
-		return s
+	if len(this.free) == 0 {
+		return nil
 	}
-	return nil
+	s := this.free[0]
+	this.free[0] = nil
+	this.free = this.free[1:]
+	return s
 }
 
 func (this *MiniMemory) Push(s *MiniSector) (err error) {
 	if err = this.check(s); err != nil {
 		return
 	}
-	_, ok := this.free[s]
+	i, ok := this.findFree(s)
 	if ok {
 		err = fmt.Errorf("Sector already added in free: %v", s)
 		return
 	}
 	s.next = FREESECT
-	this.free[s] = true
+	this.free = append(this.free, nil)
+	copy(this.free[i+1:], this.free[i:])
+	this.free[i] = s
 	return
 }
+
+// findFree returns the index of s in the free list, or the index it is
+// inserted at.
+func (this *MiniMemory) findFree(s *MiniSector) (int, bool) {
+	i := sort.Search(len(this.free), func(i int) bool {
+		return this.free[i].id >= s.id
+	})
+	return i, i < len(this.free) && this.free[i] == s
+}
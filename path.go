@@ -0,0 +1,213 @@
+package openmcdf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrNotStorage = errors.New("Not a storage")
+	ErrNotStream  = errors.New("Not a stream")
+	ErrExist      = errors.New("A directory with this name already exists")
+)
+
+// PathError records the path component an operation on a path failed on.
+// Err is NotFoundDirectory, ErrNotStorage, ErrNotStream, ErrExist or the
+// error of the underlying call.
+type PathError struct {
+	Op   string
+	Path string
+	// Component is the path up to and including the failing element.
+	Component string
+	Err       error
+}
+
+func (this *PathError) Error() string {
+	return fmt.Sprintf("%s %s: %s: %v", this.Op, this.Path, this.Component, this.Err)
+}
+
+func (this *PathError) Unwrap() error {
+	return this.Err
+}
+
+// PathFlag changes how CreateStream treats a path.
+type PathFlag uint8
+
+const (
+	// MkParents creates missing storages on the way to the stream.
+	MkParents PathFlag = 1 << iota
+)
+
+// splitPath splits a path into entry names. Paths are the names of nested
+// entries joined by "/", relative to the storage; leading and trailing
+// slashes are ignored. Names are matched case-insensitively, as in
+// GetStream and GetStorage.
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// OpenStream returns the stream at the given path below the storage.
+func (this *Storage) OpenStream(path string) (*Stream, error) {
+	de, err := this.lookup("open", path)
+	if err != nil {
+		return nil, err
+	}
+	if de.objectType != StgStream {
+		return nil, &PathError{Op: "open", Path: path, Component: strings.Join(splitPath(path), "/"), Err: ErrNotStream}
+	}
+	return de.newStream(this.cf), nil
+}
+
+// OpenStorage returns the storage at the given path below the storage. An
+// empty path gives the storage itself.
+func (this *Storage) OpenStorage(path string) (*Storage, error) {
+	return this.descend("open", path, splitPath(path), false)
+}
+
+// Exists reports whether a stream or storage exists at the given path.
+func (this *Storage) Exists(path string) bool {
+	_, err := this.lookup("stat", path)
+	return err == nil
+}
+
+// CreateStream creates an empty stream at the given path. The storages on
+// the way must exist unless MkParents is given.
+func (this *Storage) CreateStream(path string, flags ...PathFlag) (*Stream, error) {
+	var flag PathFlag
+	for _, f := range flags {
+		flag |= f
+	}
+	elems := splitPath(path)
+	if len(elems) == 0 {
+		return nil, &PathError{Op: "create", Path: path, Err: NotFoundDirectory}
+	}
+	parent, err := this.descend("create", path, elems[:len(elems)-1], flag&MkParents != 0)
+	if err != nil {
+		return nil, err
+	}
+	name := elems[len(elems)-1]
+	if de, _ := parent.getDirectory(name); de != nil {
+		return nil, &PathError{Op: "create", Path: path, Component: strings.Join(elems, "/"), Err: ErrExist}
+	}
+	sm, err := parent.AddStream(name)
+	if err != nil {
+		return nil, &PathError{Op: "create", Path: path, Component: strings.Join(elems, "/"), Err: err}
+	}
+	return sm, nil
+}
+
+// MkdirAll returns the storage at the given path, creating it and any
+// missing storage on the way.
+func (this *Storage) MkdirAll(path string) (*Storage, error) {
+	return this.descend("mkdir", path, splitPath(path), true)
+}
+
+// RemoveAll deletes the stream or storage at the given path with
+// everything below it. A path that does not exist is not an error.
+func (this *Storage) RemoveAll(path string) error {
+	elems := splitPath(path)
+	if len(elems) == 0 {
+		return &PathError{Op: "remove", Path: path, Err: errors.New("The storage cannot remove itself")}
+	}
+	parent, err := this.descend("remove", path, elems[:len(elems)-1], false)
+	if err != nil {
+		if errors.Is(err, NotFoundDirectory) {
+			return nil
+		}
+		return err
+	}
+	err = parent.Delete(elems[len(elems)-1], DeleteOptions{Recursive: true})
+	if err == NotFoundDirectory {
+		return nil
+	} else if err != nil {
+		return &PathError{Op: "remove", Path: path, Component: strings.Join(elems, "/"), Err: err}
+	}
+	return nil
+}
+
+// lookup returns the entry at the given path.
+func (this *Storage) lookup(op, path string) (*Directory, error) {
+	elems := splitPath(path)
+	if len(elems) == 0 {
+		return this.de, nil
+	}
+	parent, err := this.descend(op, path, elems[:len(elems)-1], false)
+	if err != nil {
+		return nil, err
+	}
+	de, err := parent.getDirectory(elems[len(elems)-1])
+	if err != nil || de == nil {
+		return nil, &PathError{Op: op, Path: path, Component: strings.Join(elems, "/"), Err: NotFoundDirectory}
+	}
+	return de, nil
+}
+
+// descend walks the storages named by elems, creating missing ones if
+// mkdir is set.
+func (this *Storage) descend(op, path string, elems []string, mkdir bool) (st *Storage, err error) {
+	if this == nil || this.de == nil {
+		return nil, &PathError{Op: op, Path: path, Err: errors.New("Storage is nil")}
+	}
+	st = this
+	for i, name := range elems {
+		component := strings.Join(elems[:i+1], "/")
+		if name == "" {
+			return nil, &PathError{Op: op, Path: path, Component: component, Err: NotFoundDirectory}
+		}
+		var de *Directory
+		if de, err = st.getDirectory(name); err != nil {
+			return nil, &PathError{Op: op, Path: path, Component: component, Err: err}
+		}
+		switch {
+		case de == nil && mkdir:
+			if st, err = st.AddStorage(name); err != nil {
+				return nil, &PathError{Op: op, Path: path, Component: component, Err: err}
+			}
+		case de == nil:
+			return nil, &PathError{Op: op, Path: path, Component: component, Err: NotFoundDirectory}
+		case de.objectType != StgStorage:
+			return nil, &PathError{Op: op, Path: path, Component: component, Err: ErrNotStorage}
+		default:
+			st = de.newStorage(st.cf)
+		}
+	}
+	return st, nil
+}
+
+// OpenStream returns the stream at the given path from the root storage.
+func (this *CompoundFile) OpenStream(path string) (*Stream, error) {
+	return this.RootStorage().OpenStream(path)
+}
+
+// OpenStorage returns the storage at the given path from the root storage.
+func (this *CompoundFile) OpenStorage(path string) (*Storage, error) {
+	return this.RootStorage().OpenStorage(path)
+}
+
+// Exists reports whether a stream or storage exists at the given path.
+func (this *CompoundFile) Exists(path string) bool {
+	return this.RootStorage().Exists(path)
+}
+
+// CreateStream creates an empty stream at the given path from the root
+// storage, see Storage.CreateStream.
+func (this *CompoundFile) CreateStream(path string, flags ...PathFlag) (*Stream, error) {
+	return this.RootStorage().CreateStream(path, flags...)
+}
+
+// MkdirAll returns the storage at the given path from the root storage,
+// creating it and any missing storage on the way.
+func (this *CompoundFile) MkdirAll(path string) (*Storage, error) {
+	return this.RootStorage().MkdirAll(path)
+}
+
+// RemoveAll deletes the entry at the given path from the root storage with
+// everything below it.
+func (this *CompoundFile) RemoveAll(path string) error {
+	return this.RootStorage().RemoveAll(path)
+}
@@ -0,0 +1,126 @@
+package openmcdf
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Durability is how long Save waits for the saved file to reach stable
+// storage.
+type Durability uint8
+
+const (
+	// SyncDir syncs the written file before it is renamed over the target
+	// and the directory after, so the new name survives a crash too. It is
+	// the default.
+	SyncDir Durability = iota
+	// SyncFile syncs the written file but not the directory.
+	SyncFile
+	// NoSync leaves both to the operating system. Readers still never see
+	// a partly written file.
+	NoSync
+)
+
+// SaveOptions controls Save.
+type SaveOptions struct {
+	// Mode is the permission of the saved file. Zero keeps the permission
+	// of the file being replaced, or 0644 for a new file.
+	Mode fs.FileMode
+	// Durability is how far Save syncs, SyncDir by default.
+	Durability Durability
+}
+
+// writeAtomic writes a temporary file in the directory of filename and
+// renames it over filename, so the file is either replaced as a whole or
+// left as it was. A symbolic link is followed and its target replaced.
+// rename moves the temporary file to the target; it is os.Rename if nil.
+func writeAtomic(filename string, opt SaveOptions, write func(w io.Writer) error,
+	rename func(tmp, filename string) error) (err error) {
+	if target, errLink := filepath.EvalSymlinks(filename); errLink == nil {
+		filename = target
+	}
+	mode := opt.Mode.Perm()
+	if opt.Mode == 0 {
+		mode = 0644
+		if fi, errStat := os.Stat(filename); errStat == nil {
+			mode = fi.Mode().Perm()
+		}
+	}
+
+	dir := filepath.Dir(filename)
+	var f *os.File
+	if f, err = os.CreateTemp(dir, "."+filepath.Base(filename)+".tmp*"); err != nil {
+		return
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil && tmp != "" {
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	if err = write(w); err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if err == nil && opt.Durability != NoSync {
+		err = f.Sync()
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return
+	}
+	if rename == nil {
+		rename = os.Rename
+	}
+	if err = rename(tmp, filename); err != nil {
+		return
+	}
+	tmp = ""
+	if opt.Durability == SyncDir {
+		err = syncDir(dir)
+	}
+	return
+}
+
+// replaceSource renames the temporary file Save wrote over the file the
+// compound file reads from. The source is closed first, as Windows cannot
+// rename over a file that is open, and the compound file is bound to the
+// new file as soon as the rename succeeds. If it fails, the source is
+// opened again.
+func (this *CompoundFile) replaceSource(tmp, filename string) (err error) {
+	_ = this.f.Close()
+	err = os.Rename(tmp, filename)
+	if errOpen := this.rebind(filename, err == nil); err == nil {
+		err = errOpen
+	}
+	return
+}
+
+// rebind opens the file the compound file reads from again. After Save
+// replaced it, the new file holds every sector at the same offset, so
+// nothing is left to commit.
+func (this *CompoundFile) rebind(filename string, replaced bool) (err error) {
+	flag := os.O_RDWR
+	if this.readOnly {
+		flag = os.O_RDONLY
+	}
+	var f *os.File
+	if f, err = os.OpenFile(filename, flag, 0); err != nil {
+		return
+	}
+	this.f = f
+	this.r = f
+	if replaced {
+		this.markCommitted()
+	}
+	return
+}
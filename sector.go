@@ -37,6 +37,9 @@ type Sector struct {
 	sectorType SectorType
 	///
 	modified bool
+	// shared is set while a transaction keeps the data for a rollback;
+	// the first write then copies it.
+	shared bool
 }
 
 //---------- Sector collection ----------
@@ -161,10 +164,13 @@ func (this *Sector) Close() {
 
 func (this *Sector) Read(r io.ReaderAt, off int, b []byte) (err error) {
 	if this.data == nil {
+		if r == nil {
+			err = fmt.Errorf("Sector %v is not loaded and there is no reader", this.id)
+			return
+		}
 		var n int
 		this.data = make([]byte, this.size)
-		off := int64(HeaderSize) + int64(this.id)*int64(this.size)
-		n, err = r.ReadAt(this.data, off)
+		n, err = r.ReadAt(this.data, this.offset())
 		if err != nil {
 			this.data = nil
 			return
@@ -182,10 +188,13 @@ func (this *Sector) Read(r io.ReaderAt, off int, b []byte) (err error) {
 
 func (this *Sector) read(r io.ReaderAt) (err error) {
 	if this.data == nil {
+		if r == nil {
+			err = fmt.Errorf("Sector %v is not loaded and there is no reader", this.id)
+			return
+		}
 		var n int
 		this.data = make([]byte, this.size)
-		off := int64(HeaderSize) + int64(this.id)*int64(this.size)
-		n, err = r.ReadAt(this.data, off)
+		n, err = r.ReadAt(this.data, this.offset())
 		if err != nil {
 			this.data = nil
 			return
@@ -198,6 +207,53 @@ func (this *Sector) read(r io.ReaderAt) (err error) {
 	return
 }
 
+// readAt copies the sector bytes starting at off into b. Unlike Read it
+// does not keep the sector data in memory when it has to go to the reader.
+func (this *Sector) readAt(r io.ReaderAt, off int, b []byte) (n int, err error) {
+	if off < 0 || off >= this.size {
+		return 0, fmt.Errorf("Sector %v: offset out of range: %v", this.id, off)
+	}
+	if len(b) > this.size-off {
+		b = b[:this.size-off]
+	}
+	if this.data != nil {
+		return copy(b, this.data[off:]), nil
+	}
+	if r == nil {
+		return 0, fmt.Errorf("Sector %v is not loaded and there is no reader", this.id)
+	}
+	n, err = r.ReadAt(b, this.offset()+int64(off))
+	if n == len(b) {
+		err = nil
+	} else if err == nil || err == io.EOF {
+		err = fmt.Errorf("Read less than sector size: %v", n)
+	}
+	return
+}
+
+// writeAt writes b into the sector starting at off and returns the number
+// of bytes written. The sector data must be loaded.
+func (this *Sector) writeAt(off int, b []byte) (n int, err error) {
+	if off < 0 || off >= this.size {
+		return 0, fmt.Errorf("Sector %v: offset out of range: %v", this.id, off)
+	}
+	n = len(b)
+	if n > this.size-off {
+		n = this.size - off
+	}
+	if n > 0 {
+		err = this.Write(off, b[:n])
+	}
+	return
+}
+
+// offset returns the position of the sector in the file. The header
+// fills the first sector: 512 bytes in version 3 files, and 4096 bytes,
+// padded with zeros, in version 4 files.
+func (this *Sector) offset() int64 {
+	return int64(this.id+1) * int64(this.size)
+}
+
 func (this *Sector) setNext(next uint32) {
 	this.next = next
 }
@@ -231,6 +287,10 @@ func (this *Sector) Write(offset int, data interface{}) (err error) {
 		return
 	}
 
+	if this.shared {
+		this.data = append([]byte(nil), this.data...)
+		this.shared = false
+	}
 	this.modified = true
 	switch v := data.(type) {
 	case *Directory:
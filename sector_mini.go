@@ -43,6 +43,16 @@ func (this *MiniSector) Read(r io.ReaderAt, b []byte) (err error) {
 	return
 }
 
+func (this *MiniSector) readAt(r io.ReaderAt, off int, b []byte) (int, error) {
+	if off < 0 || off >= this.size {
+		return 0, fmt.Errorf("MiniSector %v: offset out of range: %v", this.id, off)
+	}
+	if len(b) > this.size-off {
+		b = b[:this.size-off]
+	}
+	return this.sector.readAt(r, this.off+off, b)
+}
+
 func (this *MiniSector) setNext(next uint32) {
 	this.next = next
 }
@@ -62,6 +72,22 @@ func (this *MiniSector) Write(data interface{}) (err error) {
 	return
 }
 
+// writeAt writes b into the mini sector starting at off and returns the
+// number of bytes written.
+func (this *MiniSector) writeAt(off int, b []byte) (n int, err error) {
+	if off < 0 || off >= this.size {
+		return 0, fmt.Errorf("MiniSector %v: offset out of range: %v", this.id, off)
+	}
+	n = len(b)
+	if n > this.size-off {
+		n = this.size - off
+	}
+	if n > 0 {
+		err = this.sector.Write(this.off+off, b[:n])
+	}
+	return
+}
+
 func (this *MiniSector) String() string {
 	comment := ""
 	if this.next == FREESECT {
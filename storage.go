@@ -3,14 +3,27 @@ package openmcdf
 import (
 	"errors"
 	"fmt"
+	"io/fs"
+	"iter"
+	"time"
 )
 
-var NotFoundDirectory = errors.New("Directory or stream not found")
+var (
+	NotFoundDirectory  = errors.New("Directory or stream not found")
+	ErrStorageNotEmpty = errors.New("The storage is not empty")
+	ErrInvalidTree     = errors.New("Invalid directory tree")
+	ErrRootCreated     = errors.New("The root storage carries no creation time")
+	ErrDirectoryLoop   = errors.New("Directory loop")
+)
 
 type Storage struct {
 	cf   *CompoundFile
 	de   *Directory
 	tree *Tree
+	//cf.generation when the tree was loaded
+	generation int
+	//the error of the last load
+	loadErr error
 }
 
 func newStorage(de *Directory, cf *CompoundFile) *Storage {
@@ -38,12 +51,63 @@ func (this *Storage) GetStorage(name string) (*Storage, error) {
 	return de.newStorage(this.cf), nil
 }
 
+// Entries returns the streams and storages directly below the storage,
+// sorted in MS-CFB order: shorter names first, then by upper-case name.
+// A malformed sibling tree gives the entries reached before the loop,
+// together with an error wrapping ErrDirectoryLoop.
+func (this *Storage) Entries() ([]Entry, error) {
+	if this == nil || this.de == nil {
+		return nil, errors.New("Storage is nil")
+	}
+	err := this.load()
+	return this.entries(), err
+}
+
+// entries lists the tree as it was loaded.
+func (this *Storage) entries() []Entry {
+	entries := make([]Entry, 0, this.tree.Size())
+	for it := this.tree.Iterator(); it != nil; it = it.Next() {
+		entries = append(entries, it.Value.newEntry(this.cf))
+	}
+	return entries
+}
+
+// All returns an iterator over the entries directly below the storage,
+// in the order of Entries, each with a nil error. If the sibling tree is
+// malformed, the entries reached before the loop are followed by a zero
+// Entry and the error.
+func (this *Storage) All() iter.Seq2[Entry, error] {
+	return func(yield func(Entry, error) bool) {
+		entries, err := this.Entries()
+		for _, e := range entries {
+			if !yield(e, nil) {
+				return
+			}
+		}
+		if err != nil {
+			yield(Entry{}, err)
+		}
+	}
+}
+
+// Stat returns an fs.FileInfo describing the stream or storage with the
+// given name, see Entry.Stat.
+func (this *Storage) Stat(name string) (fs.FileInfo, error) {
+	de, err := this.getDirectory(name)
+	if err != nil {
+		return nil, err
+	} else if de == nil {
+		return nil, NotFoundDirectory
+	}
+	return de.newEntry(this.cf).Stat(), nil
+}
+
 func (this *Storage) getDirectory(name string) (*Directory, error) {
 	if this == nil || this.de == nil {
 		return nil, fmt.Errorf("The storage directory is nil")
 	}
-	if this.tree == nil {
-		this.loadChildren()
+	if err := this.load(); err != nil {
+		return nil, err
 	}
 	return this.tree.Find(name), nil
 }
@@ -52,15 +116,63 @@ func (this *Storage) String() string {
 	return this.de.String()
 }
 
+// CLSID returns the class id of the storage.
+func (this *Storage) CLSID() [16]byte {
+	return this.entry().clsid()
+}
+
+// SetCLSID sets the class id of the storage.
+func (this *Storage) SetCLSID(clsid [16]byte) error {
+	return this.entry().setCLSID(clsid)
+}
+
+// StateBits returns the user-defined state bits of the storage.
+func (this *Storage) StateBits() uint32 {
+	return this.entry().stateBits()
+}
+
+// SetStateBits sets the user-defined state bits of the storage.
+func (this *Storage) SetStateBits(bits uint32) error {
+	return this.entry().setStateBits(bits)
+}
+
+// Created returns the creation time of the storage.
+func (this *Storage) Created() time.Time {
+	return this.entry().created()
+}
+
+// Modified returns the modification time of the storage.
+func (this *Storage) Modified() time.Time {
+	return this.entry().modified()
+}
+
+// SetTimes sets the creation and modification times of the storage. The
+// zero time.Time clears a time. MS-CFB requires the root storage to have
+// no creation time, so for it created must be zero.
+func (this *Storage) SetTimes(created, modified time.Time) error {
+	return this.entry().setTimes(created, modified)
+}
+
+// entry returns the entry of the storage, the zero Entry if it is nil.
+func (this *Storage) entry() Entry {
+	if this == nil {
+		return Entry{}
+	}
+	return this.de.newEntry(this.cf)
+}
+
 func (this *Storage) AddStream(name string) (*Stream, error) {
 	var err error
 	if this == nil {
 		err = errors.New("Storage is nil")
 		return nil, err
 	}
+	if err = this.cf.checkWritable(); err != nil {
+		return nil, err
+	}
 	//tree
-	if this.tree == nil {
-		this.loadChildren()
+	if err = this.load(); err != nil {
+		return nil, err
 	}
 	de := this.tree.Find(name)
 	if de != nil {
@@ -74,23 +186,8 @@ func (this *Storage) AddStream(name string) (*Stream, error) {
 	node.modified = true
 	this.tree.Insert(node)
 	//update
-	it := this.tree.Iterator()
-	for it != nil {
-		if it.modified {
-			if it.modifiedValue() || it == node {
-				if err := this.cf.updateDirectory(it.Value); err != nil {
-					return nil, err
-				}
-			}
-			it.modified = false
-		}
-		it = it.Next()
-	}
-	if uint32(this.tree.root.Value.id) != this.de.childID {
-		this.de.childID = uint32(this.tree.root.Value.id)
-		if err := this.cf.updateDirectory(this.de); err != nil {
-			return nil, err
-		}
+	if err = this.flushTree(node); err != nil {
+		return nil, err
 	}
 	return de.newStream(this.cf), err
 }
@@ -101,9 +198,12 @@ func (this *Storage) AddStorage(name string) (*Storage, error) {
 		err = errors.New("Storage is nil")
 		return nil, err
 	}
+	if err = this.cf.checkWritable(); err != nil {
+		return nil, err
+	}
 	//tree
-	if this.tree == nil {
-		this.loadChildren()
+	if err = this.load(); err != nil {
+		return nil, err
 	}
 	de := this.tree.Find(name)
 	if de != nil {
@@ -117,82 +217,249 @@ func (this *Storage) AddStorage(name string) (*Storage, error) {
 	node.modified = true
 	this.tree.Insert(node)
 	//update
-	it := this.tree.Iterator()
-	for it != nil {
-		if it.modified {
-			if it.modifiedValue() || it == node {
-				if err := this.cf.updateDirectory(it.Value); err != nil {
-					return nil, err
-				}
-			}
-			it.modified = false
-		}
-		it = it.Next()
-	}
-	if uint32(this.tree.root.Value.id) != this.de.childID {
-		this.de.childID = uint32(this.tree.root.Value.id)
-		if err := this.cf.updateDirectory(this.de); err != nil {
-			return nil, err
-		}
+	if err = this.flushTree(node); err != nil {
+		return nil, err
 	}
 	return de.newStorage(this.cf), err
 }
 
-func (this *Storage) Delete(name string) (err error) {
+// DeleteOptions controls Storage.Delete.
+type DeleteOptions struct {
+	// Recursive allows deleting a storage that still has children.
+	Recursive bool
+}
+
+// Delete removes the stream or storage with the given name. The data of
+// the stream, or of every stream below the storage, is freed and the
+// directory entries are returned to the free list. Deleting a storage that
+// is not empty fails with ErrStorageNotEmpty unless Recursive is set.
+func (this *Storage) Delete(name string, opts ...DeleteOptions) (err error) {
 	if this == nil {
 		err = errors.New("Storage is nil")
 		return
 	}
-	if this.tree == nil {
-		this.loadChildren()
+	if err = this.cf.checkWritable(); err != nil {
+		return
+	}
+	var opt DeleteOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if err = this.load(); err != nil {
+		return
 	}
 	node := this.tree.findnode(name)
 	if node == nil {
 		err = NotFoundDirectory
 		return
 	}
+	de := node.Value
+	if de.objectType == StgStorage && de.childID != NOSTREAM && !opt.Recursive {
+		err = ErrStorageNotEmpty
+		return
+	}
+	//Free the data while the entry is still linked
+	if err = this.cf.freeData(de, make(map[*Directory]bool)); err != nil {
+		return
+	}
 	node.modified = true
 	this.tree.Delete(node)
 
 	//Update directory
-	it := this.tree.Iterator()
-	for it != nil {
+	if err = this.flushTree(nil); err != nil {
+		return
+	}
+	//Clear directory
+	return this.cf.releaseEntry(de)
+}
+
+// flushTree writes the entries of the tree whose color or sibling ids
+// changed, and the child id of the storage. The entry of node is written
+// in any case.
+func (this *Storage) flushTree(node *Node) (err error) {
+	for it := this.tree.Iterator(); it != nil; it = it.Next() {
 		if it.modified {
-			if it.modifiedValue() && it != node {
+			if it.modifiedValue() || it == node {
 				if err = this.cf.updateDirectory(it.Value); err != nil {
 					return
 				}
 			}
 			it.modified = false
 		}
-		it = it.Next()
 	}
-	if uint32(this.tree.root.Value.id) != this.de.childID {
-		this.de.childID = uint32(this.tree.root.Value.id)
-		if err = this.cf.updateDirectory(this.de); err != nil {
+	childID := NOSTREAM
+	if this.tree.root != nil {
+		childID = uint32(this.tree.root.Value.id)
+	}
+	if childID != this.de.childID {
+		this.de.childID = childID
+		err = this.cf.updateDirectory(this.de)
+	}
+	//Other handles of this storage reload their trees
+	this.cf.generation++
+	this.generation = this.cf.generation
+	return
+}
+
+// Rename changes the name of a stream or storage of the storage. Only the
+// directory entries change; the data stays where it is.
+func (this *Storage) Rename(oldName, newName string) error {
+	return this.Move(oldName, this, newName)
+}
+
+// Move moves a stream or storage of the storage to dst under newName.
+// Both storages must belong to the same compound file. The entry is taken
+// out of the sibling tree of this storage and put into the tree of dst;
+// no data is copied.
+func (this *Storage) Move(name string, dst *Storage, newName string) (err error) {
+	if this == nil || dst == nil {
+		return errors.New("Storage is nil")
+	}
+	if err = this.cf.checkWritable(); err != nil {
+		return
+	}
+	if this.cf != dst.cf {
+		return errors.New("Cannot move between compound files")
+	}
+	if err = NewDirectory().SetName(newName); err != nil {
+		return
+	}
+	if err = this.load(); err != nil {
+		return
+	}
+	if err = dst.load(); err != nil {
+		return
+	}
+	node := this.tree.findnode(name)
+	if node == nil {
+		return NotFoundDirectory
+	}
+	de := node.Value
+	if other := dst.tree.findnode(newName); other != nil && other.Value != de {
+		return ErrExist
+	}
+	if de.objectType == StgStorage && this.cf.contains(de, dst.de) {
+		return fmt.Errorf("Cannot move storage %q into itself", de.Name())
+	}
+
+	this.tree.Delete(node)
+	if dst.de != this.de {
+		if err = this.flushTree(nil); err != nil {
 			return
 		}
+	} else {
+		dst.tree = this.tree
 	}
-	//Clear directory
-	if err = this.cf.directory.Push(node.Value); err != nil {
+	if err = de.SetName(newName); err != nil {
 		return
 	}
-	if err = this.cf.updateDirectory(node.Value); err != nil {
+	node = NewNode(de)
+	dst.tree.Insert(node)
+	return dst.flushTree(node)
+}
+
+// contains reports whether target is de or an entry below de.
+func (this *CompoundFile) contains(de, target *Directory) bool {
+	seen := make(map[*Directory]bool)
+	var visit func(*Directory) bool
+	visit = func(d *Directory) bool {
+		if d == nil || seen[d] {
+			return false
+		}
+		seen[d] = true
+		return d == target ||
+			visit(this.directory.getLeft(d)) ||
+			visit(this.directory.getRight(d)) ||
+			visit(this.directory.getChild(d))
+	}
+	return de == target || visit(this.directory.getChild(de))
+}
+
+// freeEntry frees the data of a stream, or the descendants of a storage,
+// and returns the entry to the free list. The siblings of de are left
+// alone; seen guards against cycles in a malformed directory.
+func (this *CompoundFile) freeEntry(de *Directory, seen map[*Directory]bool) (err error) {
+	if err = this.freeData(de, seen); err != nil {
 		return
 	}
+	return this.releaseEntry(de)
+}
+
+// freeData frees the sectors of a stream or the entries of a storage.
+func (this *CompoundFile) freeData(de *Directory, seen map[*Directory]bool) (err error) {
+	seen[de] = true
+	switch de.objectType {
+	case StgStream:
+		if err = de.Truncate(this, 0); err != nil {
+			return
+		}
+	case StgStorage:
+		if err = this.freeSubtree(this.directory.getChild(de), seen); err != nil {
+			return
+		}
+	}
 	return
 }
 
-func (this *Storage) loadChildren() {
+// releaseEntry returns the directory entry to the free list.
+func (this *CompoundFile) releaseEntry(de *Directory) (err error) {
+	if err = this.directory.Push(de); err != nil {
+		return
+	}
+	return this.updateDirectory(de)
+}
+
+// freeSubtree calls freeEntry on de and all its siblings.
+func (this *CompoundFile) freeSubtree(de *Directory, seen map[*Directory]bool) (err error) {
+	if de == nil || seen[de] {
+		return
+	}
+	seen[de] = true
+	left, right := this.directory.getLeft(de), this.directory.getRight(de)
+	if err = this.freeSubtree(left, seen); err != nil {
+		return
+	}
+	if err = this.freeSubtree(right, seen); err != nil {
+		return
+	}
+	return this.freeEntry(de, seen)
+}
+
+// loadChildren builds the tree of the entries below the storage. An entry
+// reached twice through sibling ids is left out and reported with
+// ErrDirectoryLoop; the tree then holds the entries reached before.
+func (this *Storage) loadChildren() error {
 	de := this.cf.directory.getChild(this.de)
 	this.tree = NewTree(nil)
-	this.addNode(de)
+	this.generation = this.cf.generation
+	this.loadErr = this.addNode(de, make(map[*Directory]bool))
+	return this.loadErr
+}
+
+// load loads the tree when it is stale. The error of a malformed tree is
+// returned by every call, so nothing is changed on a partial tree.
+func (this *Storage) load() error {
+	if this.stale() {
+		return this.loadChildren()
+	}
+	return this.loadErr
 }
 
-func (this *Storage) addNode(de *Directory) {
+// stale reports whether the tree has to be loaded: it was never loaded,
+// or a sibling tree was changed through another handle, or a rollback
+// has restored the directory entries since.
+func (this *Storage) stale() bool {
+	return this.tree == nil || this.generation != this.cf.generation
+}
+
+func (this *Storage) addNode(de *Directory, seen map[*Directory]bool) error {
 	if de == nil {
-		return
+		return nil
+	}
+	if seen[de] {
+		return fmt.Errorf("%w: entry %d in %q is reached twice", ErrDirectoryLoop, de.id, this.de.Name())
 	}
+	seen[de] = true
 
 	node := NewNode(de)
 	this.tree.Insert(node)
@@ -200,8 +467,12 @@ func (this *Storage) addNode(de *Directory) {
 	deLeft := this.cf.directory.getLeft(node.Value)
 	deRight := this.cf.directory.getRight(node.Value)
 
-	this.addNode(deLeft)
-	this.addNode(deRight)
+	errLeft := this.addNode(deLeft, seen)
+	errRight := this.addNode(deRight, seen)
+	if errLeft != nil {
+		return errLeft
+	}
+	return errRight
 }
 
 func (this *Storage) loadSiblings(node *Node) {
@@ -227,3 +498,78 @@ func (this *Storage) loadSiblings(node *Node) {
 	this.loadSiblings(node.left)
 	this.loadSiblings(node.right)
 }
+
+// rebalance writes the red-black trees built on loading back to the
+// sibling ids of this storage and of every storage below it.
+func (this *Storage) rebalance() (err error) {
+	if err = this.load(); err != nil {
+		return
+	}
+	for it := this.tree.Iterator(); it != nil; it = it.Next() {
+		if it.modifiedValue() {
+			if err = this.cf.updateDirectory(it.Value); err != nil {
+				return
+			}
+		}
+	}
+	childID := NOSTREAM
+	if this.tree.root != nil {
+		childID = uint32(this.tree.root.Value.id)
+	}
+	if childID != this.de.childID {
+		this.de.childID = childID
+		if err = this.cf.updateDirectory(this.de); err != nil {
+			return
+		}
+	}
+	for it := this.tree.Iterator(); it != nil; it = it.Next() {
+		if it.Value.objectType == StgStorage {
+			if err = it.Value.newStorage(this.cf).rebalance(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// checkTrees walks the sibling trees as they are stored in the file. It
+// fails with ErrInvalidTree on ids out of range, entries reached twice
+// and, if order is set, siblings not sorted by the MS-CFB comparison.
+func (this *CompoundFile) checkTrees(order bool) error {
+	seen := map[uint32]bool{uint32(this.root.de.id): true}
+	return this.checkSubtree(this.root.de, this.root.de.childID, nil, nil, seen, order)
+}
+
+// checkSubtree checks the entry id of the children of parent and its
+// siblings. The names in the subtree must sort between min and max.
+func (this *CompoundFile) checkSubtree(parent *Directory, id uint32, min, max []uint16,
+	seen map[uint32]bool, order bool) (err error) {
+	if id == NOSTREAM {
+		return
+	}
+	if int(id) >= this.directory.Len() {
+		return fmt.Errorf("%w: entry %d in %q is out of range", ErrInvalidTree, id, parent.Name())
+	}
+	if seen[id] {
+		return fmt.Errorf("%w: entry %d in %q is reached twice", ErrInvalidTree, id, parent.Name())
+	}
+	seen[id] = true
+	de := this.directory.data[id]
+	if de.objectType != StgStream && de.objectType != StgStorage {
+		return fmt.Errorf("%w: entry %d in %q is neither a stream nor a storage", ErrInvalidTree, id, parent.Name())
+	}
+	key := nameKey(de.Name())
+	if order && (min != nil && compareKeys(key, min) <= 0 || max != nil && compareKeys(key, max) >= 0) {
+		return fmt.Errorf("%w: %q is out of order in %q", ErrInvalidTree, de.Name(), parent.Name())
+	}
+	if err = this.checkSubtree(parent, de.leftSiblingID, min, key, seen, order); err != nil {
+		return
+	}
+	if err = this.checkSubtree(parent, de.rightSiblingID, key, max, seen, order); err != nil {
+		return
+	}
+	if de.objectType == StgStorage {
+		err = this.checkSubtree(de, de.childID, nil, nil, seen, order)
+	}
+	return
+}
@@ -2,13 +2,24 @@ package openmcdf
 
 import (
 	"errors"
+	"io"
+	"time"
 )
 
-var StreamNotFound = errors.New("Stream not found")
+var (
+	StreamNotFound = errors.New("Stream not found")
+	ErrStreamTimes = errors.New("Streams carry no creation or modification time")
+)
 
+// Stream is a stream entry of a compound file. Besides GetData and SetData
+// it implements io.Reader, io.Seeker, io.ReaderAt and io.WriterTo, reading
+// only the sectors the requested range needs.
 type Stream struct {
-	cf *CompoundFile
-	de *Directory
+	cf  *CompoundFile
+	de  *Directory
+	pos int64
+	//the chain position of Read and WriteTo
+	chain chainPos
 }
 
 func newStream(de *Directory, cf *CompoundFile) *Stream {
@@ -29,6 +40,51 @@ func (this *Stream) String() string {
 	return this.de.String()
 }
 
+// CLSID returns the class id of the stream.
+func (this *Stream) CLSID() [16]byte {
+	return this.entry().clsid()
+}
+
+// SetCLSID sets the class id of the stream.
+func (this *Stream) SetCLSID(clsid [16]byte) error {
+	return this.entry().setCLSID(clsid)
+}
+
+// StateBits returns the user-defined state bits of the stream.
+func (this *Stream) StateBits() uint32 {
+	return this.entry().stateBits()
+}
+
+// SetStateBits sets the user-defined state bits of the stream.
+func (this *Stream) SetStateBits(bits uint32) error {
+	return this.entry().setStateBits(bits)
+}
+
+// Created returns the creation time of the stream.
+func (this *Stream) Created() time.Time {
+	return this.entry().created()
+}
+
+// Modified returns the modification time of the stream.
+func (this *Stream) Modified() time.Time {
+	return this.entry().modified()
+}
+
+// SetTimes sets the creation and modification times of the stream.
+// MS-CFB requires streams to carry zero times, so only the zero time.Time
+// is accepted; it clears times read from a non-conforming file.
+func (this *Stream) SetTimes(created, modified time.Time) error {
+	return this.entry().setTimes(created, modified)
+}
+
+// entry returns the entry of the stream, the zero Entry if it is nil.
+func (this *Stream) entry() Entry {
+	if this == nil {
+		return Entry{}
+	}
+	return this.de.newEntry(this.cf)
+}
+
 func (this *Stream) Size() int64 {
 	if this == nil {
 		return 0
@@ -45,18 +101,188 @@ func (this *Stream) SetData(b []byte) (err error) {
 		err = errors.New("Error set data: directory is nil")
 		return
 	}
+	if err = this.cf.checkWritable(); err != nil {
+		return
+	}
 
 	err = this.de.Write(this.cf, b)
 	return
 }
 
+// Append adds b to the end of the stream. The existing sector chain is
+// extended, so the cost depends only on len(b).
 func (this *Stream) Append(b []byte) (err error) {
-	buf, err := this.GetData()
-	if err != nil {
+	if err = this.check(); err != nil {
+		return
+	}
+	if err = this.cf.checkWritable(); err != nil {
+		return
+	}
+	return this.de.Append(this.cf, b)
+}
+
+// WriteAt overwrites len(p) bytes of the stream starting at off. Only
+// the sectors covering the range are rewritten, so the stream keeps its
+// place in the file; the chain is extended when the range goes past the
+// end of the stream.
+func (this *Stream) WriteAt(p []byte, off int64) (n int, err error) {
+	if err = this.check(); err != nil {
+		return
+	}
+	if err = this.cf.checkWritable(); err != nil {
+		return
+	}
+	if err = this.de.WriteAt(this.cf, p, off); err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+// Truncate changes the size of the stream. Sectors past the new end are
+// freed and a longer stream is filled with zeros.
+func (this *Stream) Truncate(size int64) (err error) {
+	if err = this.check(); err != nil {
+		return
+	}
+	if err = this.cf.checkWritable(); err != nil {
+		return
+	}
+	return this.de.Truncate(this.cf, size)
+}
+
+// Writer returns a writer that replaces the stream data. Sectors are
+// allocated as data arrives: the data stays in the mini stream until it
+// grows past the mini stream cutoff size and then moves to regular sectors.
+func (this *Stream) Writer() io.WriteCloser {
+	return &streamWriter{stream: this}
+}
+
+type streamWriter struct {
+	stream  *Stream
+	started bool
+	closed  bool
+}
+
+func (this *streamWriter) start() (err error) {
+	if this.closed {
+		return errors.New("Stream writer is closed")
+	}
+	if this.started {
+		return
+	}
+	if err = this.stream.check(); err != nil {
+		return
+	}
+	if err = this.stream.cf.checkWritable(); err != nil {
+		return
+	}
+	if err = this.stream.de.Write(this.stream.cf, []byte{}); err != nil {
 		return
 	}
-	buf = append(buf, b...)
+	this.started = true
+	return
+}
 
-	err = this.de.Write(this.cf, buf)
+func (this *streamWriter) Write(p []byte) (n int, err error) {
+	if err = this.start(); err != nil {
+		return
+	}
+	if err = this.stream.de.Append(this.stream.cf, p); err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+func (this *streamWriter) Close() (err error) {
+	if err = this.start(); err != nil {
+		return
+	}
+	this.closed = true
+	return
+}
+
+func (this *Stream) check() error {
+	if this == nil {
+		return errors.New("Stream is null")
+	} else if this.de == nil {
+		return errors.New("Directory is null")
+	}
+	return nil
+}
+
+// Read reads up to len(p) bytes from the current position.
+func (this *Stream) Read(p []byte) (n int, err error) {
+	if err = this.check(); err != nil {
+		return
+	}
+	if len(p) == 0 {
+		return
+	}
+	n, err = this.de.ReadAt(this.cf, p, this.pos, &this.chain)
+	this.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// ReadAt reads len(p) bytes starting at off. It does not change the
+// current position. Calls may run in parallel, as long as nothing writes
+// to the compound file at the same time.
+func (this *Stream) ReadAt(p []byte, off int64) (n int, err error) {
+	if err = this.check(); err != nil {
+		return
+	}
+	return this.de.ReadAt(this.cf, p, off, &chainPos{})
+}
+
+// Seek sets the position for the next Read.
+func (this *Stream) Seek(offset int64, whence int) (int64, error) {
+	if err := this.check(); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += this.pos
+	case io.SeekEnd:
+		offset += this.Size()
+	default:
+		return 0, errors.New("Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("Seek: negative position")
+	}
+	this.pos = offset
+	return offset, nil
+}
+
+// WriteTo writes the stream data from the current position to w.
+func (this *Stream) WriteTo(w io.Writer) (n int64, err error) {
+	if err = this.check(); err != nil {
+		return
+	}
+	buf := make([]byte, 8*this.cf.SectorSize())
+	for this.pos < this.Size() {
+		var m int
+		m, err = this.de.ReadAt(this.cf, buf, this.pos, &this.chain)
+		if m > 0 {
+			var k int
+			k, err = w.Write(buf[:m])
+			n += int64(k)
+			this.pos += int64(k)
+			if err != nil {
+				return
+			}
+			if k < m {
+				return n, io.ErrShortWrite
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return
+		}
+	}
 	return
 }
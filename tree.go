@@ -1,7 +1,5 @@
 package openmcdf
 
-import "strings"
-
 type Tree struct {
 	root *Node
 	size int
@@ -12,6 +10,7 @@ type Node struct {
 	color               int
 	Key                 string
 	Value               *Directory
+	key                 []uint16
 	modified            bool
 }
 
@@ -28,7 +27,8 @@ func (this *Tree) GetRoot() *Node {
 }
 
 func NewNode(de *Directory) *Node {
-	return &Node{Value: de, Key: de.Name()}
+	name := de.Name()
+	return &Node{Value: de, Key: name, key: nameKey(name)}
 }
 
 func (this *Tree) Insert(z *Node) {
@@ -37,8 +37,7 @@ func (this *Tree) Insert(z *Node) {
 
 	for x != nil {
 		y = x
-		//LessThan
-		if strings.Compare(z.Key, x.Key) > 0 {
+		if compareKeys(z.key, x.key) < 0 {
 			x = x.left
 		} else {
 			x = x.right
@@ -55,8 +54,7 @@ func (this *Tree) Insert(z *Node) {
 		z.color = Black
 		this.root = z
 		return
-		//LessThan
-	} else if strings.Compare(z.Key, y.Key) > 0 {
+	} else if compareKeys(z.key, y.key) < 0 {
 		y.left = z
 		y.modified = true
 	} else {
@@ -88,12 +86,12 @@ func (t *Tree) Delete(z *Node) {
 		x = y.right
 
 		if y.parent == z {
-			if x == nil {
-				parent = y
-			} else {
+			parent = y
+			if x != nil {
 				x.parent = y
 			}
 		} else {
+			parent = y.parent
 			t.transplant(y, y.right)
 			y.right = z.right
 			y.right.parent = y
@@ -300,16 +298,18 @@ func (t *Tree) Find(key string) *Directory {
 	return nil
 }
 
-func (t *Tree) findnode(key string) *Node {
+// findnode looks the name up with the MS-CFB comparison, so the lookup
+// ignores case.
+func (t *Tree) findnode(name string) *Node {
+	key := nameKey(name)
 	x := t.root
 	for x != nil {
-		//LessThan
-		if strings.Compare(key, x.Key) > 0 {
+		switch c := compareKeys(key, x.key); {
+		case c == 0:
+			return x
+		case c < 0:
 			x = x.left
-		} else {
-			if key == x.Key {
-				return x
-			}
+		default:
 			x = x.right
 		}
 	}
@@ -334,6 +334,9 @@ func (t *Tree) transplant(u, v *Node) {
 }
 
 func (t *Tree) Iterator() *Node {
+	if t.root == nil {
+		return nil
+	}
 	return minimum(t.root)
 }
 
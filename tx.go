@@ -0,0 +1,180 @@
+package openmcdf
+
+import (
+	"errors"
+)
+
+var (
+	ErrTxActive = errors.New("A transaction is active")
+	ErrTxDone   = errors.New("The transaction has already been committed or rolled back")
+)
+
+// Tx is an in-memory transaction on a compound file, see Begin.
+type Tx struct {
+	cf   *CompoundFile
+	done bool
+
+	header                     *Header
+	headerValue                Header
+	sectorSize, miniSectorSize int
+	root                       *Storage
+
+	memory      *Memory
+	memoryValue Memory
+	sectors     *SectorCollection
+	sectorData  []*Sector
+	sectorValue map[*Sector]Sector
+
+	mini        *MiniMemory
+	miniValue   MiniMemory
+	miniSectors map[*MiniSector]MiniSector
+
+	directory      *DirectoryCollection
+	directoryValue DirectoryCollection
+	entries        map[*Directory]Directory
+}
+
+// Begin starts a transaction. The changes made until Tx.Commit or
+// Tx.Rollback can be undone as a whole: Rollback puts the header,
+// sectors, FAT and mini FAT tables and directory entries back as they
+// were. Sector data is shared with the transaction and only copied when
+// a sector is first written. The compound file cannot be committed to
+// disk while a transaction is active.
+func (this *CompoundFile) Begin() (tx *Tx, err error) {
+	if this == nil || this.header == nil {
+		return nil, WrongFormat
+	}
+	if err = this.checkWritable(); err != nil {
+		return
+	}
+	if this.tx != nil {
+		return nil, ErrTxActive
+	}
+	tx = &Tx{
+		cf:             this,
+		header:         this.header,
+		headerValue:    *this.header,
+		sectorSize:     this.sectorSize,
+		miniSectorSize: this.miniSectorSize,
+		root:           this.root,
+	}
+
+	tx.memory = this.memory
+	tx.memoryValue = *this.memory
+	tx.memoryValue.data = make([][]*Sector, len(this.memory.data))
+	for t, sectors := range this.memory.data {
+		tx.memoryValue.data[t] = append([]*Sector(nil), sectors...)
+	}
+	tx.memoryValue.set = make(map[*Sector]string, len(this.memory.set))
+	for s, t := range this.memory.set {
+		tx.memoryValue.set[s] = t
+	}
+
+	tx.sectors = this.sectors
+	tx.sectorData = append([]*Sector(nil), this.sectors.data...)
+	tx.sectorValue = make(map[*Sector]Sector, len(this.sectors.data))
+	for _, s := range this.sectors.data {
+		if s != nil {
+			tx.sectorValue[s] = *s
+			s.shared = true
+		}
+	}
+	//Sectors taken out of the collection are still in the free list
+	for _, s := range this.memory.data[MemoryFree] {
+		if _, ok := tx.sectorValue[s]; !ok {
+			tx.sectorValue[s] = *s
+			s.shared = true
+		}
+	}
+
+	tx.mini = this.mini
+	tx.miniValue = *this.mini
+	tx.miniValue.data = append([]*MiniSector(nil), this.mini.data...)
+	tx.miniValue.free = append([]*MiniSector(nil), this.mini.free...)
+	tx.miniSectors = make(map[*MiniSector]MiniSector, len(this.mini.data)+len(this.mini.free))
+	for _, s := range this.mini.data {
+		tx.miniSectors[s] = *s
+	}
+	for _, s := range this.mini.free {
+		tx.miniSectors[s] = *s
+	}
+
+	tx.directory = this.directory
+	tx.directoryValue = *this.directory
+	tx.directoryValue.data = append([]*Directory(nil), this.directory.data...)
+	tx.directoryValue.free = make(map[*Directory]bool, len(this.directory.free))
+	tx.entries = make(map[*Directory]Directory, len(this.directory.data))
+	for _, de := range this.directory.data {
+		tx.entries[de] = *de
+	}
+	for de := range this.directory.free {
+		tx.directoryValue.free[de] = true
+	}
+
+	this.tx = tx
+	return
+}
+
+// Commit ends the transaction and keeps its changes. They are written to
+// disk by the next CompoundFile.Commit or Save as usual.
+func (this *Tx) Commit() error {
+	if err := this.end(); err != nil {
+		return err
+	}
+	//Also the sectors of the free list
+	for s := range this.sectorValue {
+		s.shared = false
+	}
+	return nil
+}
+
+// Rollback ends the transaction and undoes its changes. Storages and
+// streams obtained from the compound file before Begin stay valid: every
+// storage reloads its children from the restored directory entries.
+func (this *Tx) Rollback() error {
+	if err := this.end(); err != nil {
+		return err
+	}
+	cf := this.cf
+
+	*this.header = this.headerValue
+	cf.header = this.header
+	cf.sectorSize, cf.miniSectorSize = this.sectorSize, this.miniSectorSize
+
+	for s, v := range this.sectorValue {
+		*s = v
+	}
+	this.sectors.data = this.sectorData
+	cf.sectors = this.sectors
+	*this.memory = this.memoryValue
+	cf.memory = this.memory
+
+	for s, v := range this.miniSectors {
+		*s = v
+	}
+	*this.mini = this.miniValue
+	cf.mini = this.mini
+
+	for de, v := range this.entries {
+		*de = v
+	}
+	*this.directory = this.directoryValue
+	cf.directory = this.directory
+
+	//The trees of all storages are loaded again when next used
+	cf.generation++
+	cf.root = this.root
+	return nil
+}
+
+func (this *Tx) end() error {
+	if this == nil || this.cf == nil {
+		return errors.New("Transaction is nil")
+	}
+	if this.done {
+		return ErrTxDone
+	}
+	this.done = true
+	this.cf.tx = nil
+	return nil
+}
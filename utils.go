@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"time"
 )
@@ -96,12 +97,13 @@ func WriteData(w io.Writer, data interface{}) error {
 
 ///////////////////////////////////////////////
 
-func RecoverError(err error) {
+// RecoverError turns a panic raised by check into the error err points
+// to. It has to be deferred directly: defer RecoverError(&err).
+func RecoverError(err *error) {
 	if r := recover(); r != nil {
 		var ok bool
-		err, ok = r.(error)
-		if !ok {
-			err = fmt.Errorf("%v", r)
+		if *err, ok = r.(error); !ok {
+			*err = fmt.Errorf("%v", r)
 		}
 	}
 }
@@ -114,14 +116,36 @@ func check(err error) {
 
 ///////////////////////////////////////////////
 
+// epochDelta is the number of FILETIME intervals between 1601-01-01 and
+// the Unix epoch.
+const epochDelta = 116444736000000000
+
+// ToTime converts a FILETIME, the number of 100 ns intervals since
+// 1601-01-01 UTC, to a time. Zero stands for no time and gives the zero
+// time.Time.
 func ToTime(t uint64) time.Time {
-	//Seconds
-	t1 := int64(t / 10000000)
-	//Fractional amount of a second
-	t2 := int64(t % 10000000)
-	return time.Unix(t1, t2)
+	if t == 0 || t > math.MaxInt64 {
+		return time.Time{}
+	}
+	ticks := int64(t) - epochDelta
+	//Seconds and the fractional amount of a second
+	sec, frac := ticks/10000000, ticks%10000000
+	return time.Unix(sec, frac*100).UTC()
 }
 
+// toTimestamp converts a time to a FILETIME. The zero time.Time and times
+// before 1601 give zero.
 func toTimestamp(t time.Time) uint64 {
-	return uint64(t.UTC().Unix())
+	if t.IsZero() {
+		return 0
+	}
+	sec := t.Unix()
+	//Seconds before 1601 or so far ahead that the ticks overflow
+	if sec < -epochDelta/10000000 || sec > (math.MaxInt64-epochDelta)/10000000-1 {
+		if sec < 0 {
+			return 0
+		}
+		return math.MaxInt64
+	}
+	return uint64(sec*10000000 + int64(t.Nanosecond()/100) + epochDelta)
 }
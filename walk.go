@@ -0,0 +1,99 @@
+package openmcdf
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+var (
+	// SkipDir returned by a WalkFunc skips the storage it was called for,
+	// or the remaining entries of the storage when called for a stream.
+	SkipDir = fs.SkipDir
+	// SkipAll returned by a WalkFunc stops the walk.
+	SkipAll = fs.SkipAll
+)
+
+// WalkFunc is called by Walk for every entry, see fs.WalkDirFunc. The root
+// storage has the path "."; the path of any other entry is the names from
+// the root joined by "/".
+type WalkFunc func(path string, e Entry, err error) error
+
+// WalkOptions controls CompoundFile.Walk.
+type WalkOptions struct {
+	// MaxDepth stops the walk at storages MaxDepth levels below the root:
+	// they are reported but not entered. Zero means no limit.
+	MaxDepth int
+}
+
+// Walk calls fn for the root storage and every entry below it, in the order
+// of Storage.Entries, the way fs.WalkDir walks a file tree. A storage whose
+// children cannot be read is reported to fn a second time with the error.
+// A storage that is its own ancestor in a malformed file is reported with
+// ErrDirectoryLoop and not entered.
+func (this *CompoundFile) Walk(fn WalkFunc, opts ...WalkOptions) error {
+	if this == nil || this.root == nil {
+		return WrongFormat
+	}
+	var opt WalkOptions
+	for _, o := range opts {
+		opt = o
+	}
+	err := this.walk(".", this.root.de.newEntry(this), fn, opt.MaxDepth, 0, make(map[*Directory]bool))
+	if err == SkipDir || err == SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (this *CompoundFile) walk(path string, e Entry, fn WalkFunc, maxDepth, depth int,
+	ancestors map[*Directory]bool) error {
+	if err := fn(path, e, nil); err != nil || !e.IsStorage() {
+		if err == SkipDir && e.IsStorage() {
+			err = nil
+		}
+		return err
+	}
+	if maxDepth > 0 && depth >= maxDepth {
+		return nil
+	}
+
+	st, err := e.Storage()
+	if err == nil {
+		err = st.loadChildren()
+	}
+	if err != nil {
+		if err = fn(path, e, err); err != nil {
+			if err == SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	if st == nil {
+		return nil
+	}
+
+	ancestors[e.de] = true
+	defer delete(ancestors, e.de)
+	for _, child := range st.entries() {
+		name := child.Name()
+		if path != "." {
+			name = path + "/" + name
+		}
+		if child.IsStorage() && ancestors[child.de] {
+			err = fn(name, child, fmt.Errorf("%w: %q contains its ancestor", ErrDirectoryLoop, name))
+			if err == SkipDir {
+				err = nil
+			}
+		} else {
+			err = this.walk(name, child, fn, maxDepth, depth+1, ancestors)
+		}
+		if err != nil {
+			if err == SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}